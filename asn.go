@@ -0,0 +1,50 @@
+package cdn
+
+import (
+	"errors"
+	"net"
+	"slices"
+	"sync/atomic"
+)
+
+// ASNResolver returns the autonomous system numbers that announce ip, e.g.
+// from a WHOIS, RDAP or MaxMind lookup.
+type ASNResolver func(ip net.IP) ([]int, error)
+
+// ErrNoASNResolver is returned by VerifyWithASN before SetASNResolver is
+// called.
+var ErrNoASNResolver = errors.New("no ASN resolver configured")
+
+// asnResolver holds the resolver set with SetASNResolver, nil meaning none.
+var asnResolver atomic.Pointer[ASNResolver]
+
+// SetASNResolver sets the resolver used by VerifyWithASN; nil removes it.
+// The package does not ship one. It is safe to call while lookups are
+// running.
+func SetASNResolver(r ASNResolver) {
+	if r == nil {
+		asnResolver.Store(nil)
+		return
+	}
+	asnResolver.Store(&r)
+}
+
+// VerifyWithASN reports whether ip is announced by any of expectedASNs. It
+// is meant to confirm a QueryName result and weed out matches caused by
+// stale provider lists.
+func VerifyWithASN(ip net.IP, expectedASNs ...int) (bool, error) {
+	resolve := asnResolver.Load()
+	if resolve == nil {
+		return false, ErrNoASNResolver
+	}
+	asns, err := (*resolve)(ip)
+	if err != nil {
+		return false, err
+	}
+	for _, asn := range asns {
+		if slices.Contains(expectedASNs, asn) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
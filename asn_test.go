@@ -0,0 +1,59 @@
+package cdn
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestVerifyWithASN(t *testing.T) {
+	if _, err := VerifyWithASN(net.ParseIP("104.16.1.1"), 13335); !errors.Is(err, ErrNoASNResolver) {
+		t.Errorf("err = %v; want ErrNoASNResolver", err)
+	}
+
+	SetASNResolver(func(ip net.IP) ([]int, error) {
+		switch ip.String() {
+		case "104.16.1.1":
+			return []int{13335}, nil
+		case "151.101.1.1":
+			return []int{54113}, nil
+		}
+		return nil, errors.New("not found")
+	})
+	defer SetASNResolver(nil)
+
+	tests := []struct {
+		ip   string
+		asns []int
+		want bool
+		err  bool
+	}{
+		{"104.16.1.1", []int{13335}, true, false},
+		{"104.16.1.1", []int{54113, 16509}, false, false},
+		{"151.101.1.1", []int{13335, 54113}, true, false},
+		{"192.0.2.1", []int{13335}, false, true},
+	}
+	for _, tt := range tests {
+		got, err := VerifyWithASN(net.ParseIP(tt.ip), tt.asns...)
+		if got != tt.want || (err != nil) != tt.err {
+			t.Errorf("VerifyWithASN(%s, %v) = %v, %v", tt.ip, tt.asns, got, err)
+		}
+	}
+}
+
+func TestSetASNResolverDuringLookups(t *testing.T) {
+	defer SetASNResolver(nil)
+	resolver := func(net.IP) ([]int, error) { return []int{13335}, nil }
+	SetASNResolver(resolver)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			VerifyWithASN(net.ParseIP("104.16.1.1"), 13335)
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		SetASNResolver(resolver)
+	}
+	<-done
+}
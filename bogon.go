@@ -0,0 +1,46 @@
+package cdn
+
+import "net"
+
+// bogonNets are the ranges that are never routed on the Internet, so an
+// address in them can't belong to a CDN.
+var bogonNets = []net.IPNet{
+	{IP: net.IP{0, 0, 0, 0}, Mask: net.CIDRMask(8, 32)},                      // "this" network
+	{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(8, 32)},                     // RFC 1918
+	{IP: net.IP{100, 64, 0, 0}, Mask: net.CIDRMask(10, 32)},                  // carrier-grade NAT
+	{IP: net.IP{127, 0, 0, 0}, Mask: net.CIDRMask(8, 32)},                    // loopback
+	{IP: net.IP{169, 254, 0, 0}, Mask: net.CIDRMask(16, 32)},                 // link-local
+	{IP: net.IP{172, 16, 0, 0}, Mask: net.CIDRMask(12, 32)},                  // RFC 1918
+	{IP: net.IP{192, 0, 0, 0}, Mask: net.CIDRMask(24, 32)},                   // IETF protocol assignments
+	{IP: net.IP{192, 0, 2, 0}, Mask: net.CIDRMask(24, 32)},                   // documentation
+	{IP: net.IP{192, 168, 0, 0}, Mask: net.CIDRMask(16, 32)},                 // RFC 1918
+	{IP: net.IP{198, 18, 0, 0}, Mask: net.CIDRMask(15, 32)},                  // benchmarking
+	{IP: net.IP{198, 51, 100, 0}, Mask: net.CIDRMask(24, 32)},                // documentation
+	{IP: net.IP{203, 0, 113, 0}, Mask: net.CIDRMask(24, 32)},                 // documentation
+	{IP: net.IP{224, 0, 0, 0}, Mask: net.CIDRMask(4, 32)},                    // multicast
+	{IP: net.IP{240, 0, 0, 0}, Mask: net.CIDRMask(4, 32)},                    // reserved and broadcast
+	{IP: net.IPv6unspecified, Mask: net.CIDRMask(128, 128)},                  // unspecified
+	{IP: net.IPv6loopback, Mask: net.CIDRMask(128, 128)},                     // loopback
+	{IP: net.IP{0x01, 15: 0}, Mask: net.CIDRMask(64, 128)},                   // discard
+	{IP: net.IP{0x20, 0x01, 0x0d, 0xb8, 15: 0}, Mask: net.CIDRMask(32, 128)}, // documentation
+	{IP: net.IP{0xfc, 15: 0}, Mask: net.CIDRMask(7, 128)},                    // unique local
+	{IP: net.IP{0xfe, 0x80, 15: 0}, Mask: net.CIDRMask(10, 128)},             // link-local
+	{IP: net.IP{0xff, 15: 0}, Mask: net.CIDRMask(8, 128)},                    // multicast
+}
+
+// IsPrivateOrBogon reports whether ip is in a range that is never routed on
+// the Internet: the private ranges of RFC 1918 and their IPv6 counterpart
+// fc00::/7, loopback, link-local, carrier-grade NAT, multicast, documentation
+// and reserved addresses. IPv4-mapped IPv6 addresses are checked as IPv4. An invalid ip
+// is reported as a bogon.
+func IsPrivateOrBogon(ip net.IP) bool {
+	if ip = normalizeIP(ip); ip == nil {
+		return true
+	}
+	for _, n := range bogonNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package cdn
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsPrivateOrBogon(t *testing.T) {
+	for _, tt := range []struct {
+		addr string
+		want bool
+	}{
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"172.31.255.255", true},
+		{"172.32.0.1", false},
+		{"192.168.1.1", true},
+		{"127.0.0.1", true},
+		{"169.254.169.254", true},
+		{"100.64.0.1", true},
+		{"0.0.0.0", true},
+		{"224.0.0.251", true},
+		{"255.255.255.255", true},
+		{"::ffff:10.0.0.1", true},
+		{"::1", true},
+		{"::", true},
+		{"fd00::1", true},
+		{"fe80::1", true},
+		{"ff02::1", true},
+		{"104.16.1.1", false},
+		{"8.8.8.8", false},
+		{"2606:4700::1", false},
+		{"192.0.2.1", true},
+		{"198.51.100.1", true},
+		{"203.0.113.1", true},
+		{"2001:db8::1", true},
+	} {
+		if got := IsPrivateOrBogon(net.ParseIP(tt.addr)); got != tt.want {
+			t.Errorf("IsPrivateOrBogon(%s) = %v; want %v", tt.addr, got, tt.want)
+		}
+	}
+	if !IsPrivateOrBogon(nil) {
+		t.Error("IsPrivateOrBogon(nil) = false")
+	}
+}
+
+func TestQueryNameSkipsBogons(t *testing.T) {
+	restoreConfig(t)
+	p := newStaticProvider("internal", "10.0.0.0/8")
+	withProviders(t, p)
+	if name := QueryName(net.ParseIP("10.1.2.3")); name != "" {
+		t.Errorf("QueryName of a private address = %q; want \"\"", name)
+	}
+	if n := p.calls.Load(); n != 0 {
+		t.Errorf("private address fetched ranges %d times", n)
+	}
+	SetOptions(WithBogonFilter(false))
+	if name := QueryName(net.ParseIP("10.1.2.3")); name != "internal" {
+		t.Errorf("without the filter QueryName = %q; want internal", name)
+	}
+}
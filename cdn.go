@@ -1,22 +1,63 @@
 package cdn
 
 import (
+	"context"
+	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
 	"io"
+	"io/fs"
+	"maps"
+	"mime"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 )
 
+// provider fetches a CDN's ranges from their source with FetchIPRanges,
+// serves them through the cache with FetchIPRangesWithCache and describes
+// itself with Meta. The types that
+// embed defaultProvider each implement FetchIPRangesWithCache by passing
+// themselves to fetchWithCache, and contextBinder by returning a copy of
+// themselves: a method promoted from defaultProvider would only see the
+// defaultProvider, not the FetchIPRanges of the type embedding it.
 type provider interface {
 	FetchIPRanges() ([]string, error)
-	FetchIPRangesWithCache(provider) ([]string, error)
+	FetchIPRangesWithCache(ctx context.Context) ([]string, error)
+	Meta() ProviderMeta
+}
+
+// contextBinder is implemented by providers whose requests can be cancelled:
+// withContext returns a copy of the provider making its requests with ctx.
+type contextBinder interface {
+	withContext(ctx context.Context) provider
+}
+
+// withContext returns p making its requests with ctx, or p itself if its
+// requests can't be cancelled.
+func withContext(p provider, ctx context.Context) provider {
+	if b, ok := p.(contextBinder); ok {
+		return b.withContext(ctx)
+	}
+	return p
+}
+
+// configurer is implemented by providers that have no ranges until they are
+// configured, e.g. with SetProviderURL. Until then they are in use only if
+// named with SetEnabledProviders, so that they don't fail every call that
+// covers all providers.
+type configurer interface {
+	configured() bool
 }
 
 const (
@@ -25,67 +66,306 @@ const (
 	CacheFly   = "cachefly"
 	CloudFlare = "cloudflare"
 	CloudFront = "cloudfront"
+	Edgecast   = "edgecast"
 	Fastly     = "fastly"
 	GCore      = "gcore"
 	Google     = "google"
 	Key        = "key"
+	Mediahub   = "mediahub"
+	Myra       = "myra"
+	PerimeterX = "perimeterx"
 	Quic       = "quic"
+	Reblaze    = "reblaze"
+	Section    = "section"
+	Yandex     = "yandex"
+
+	// CloudFlareAccess is the list of addresses Cloudflare Access (Zero
+	// Trust) reaches origins from, kept apart from the cloudflare provider.
+	// Cloudflare publishes no such list at a fixed URL, so it is empty until
+	// set with SetProviderURL.
+	CloudFlareAccess = "cloudflare-access"
+
+	// CloudFlareWarp is the ranges Cloudflare's WARP VPN egresses from,
+	// which are not part of the cloudflare provider's edge ranges.
+	CloudFlareWarp = "cloudflare-warp"
+
+	// CloudFrontRegional is the ranges of CloudFront's regional edge caches,
+	// which the cloudfront provider also covers, cached separately.
+	CloudFrontRegional = "cloudfront-regional"
+
+	// MaxCDNHistorical is a frozen snapshot of the ranges MaxCDN used before
+	// it was absorbed by StackPath and later Fastly. It is never refreshed.
+	//
+	// Deprecated: only useful for analysing historical logs.
+	MaxCDNHistorical = "maxcdn-historical"
 )
 
+// Providers holds the providers of the default client. The built-in
+// providers are added to it on the default client's first use, such as a
+// call to GetProvider or Configure, so that importing the package constructs
+// none of them; providers already in it by then are kept. Add to it with
+// RegisterProvider once lookups may be running.
+//
+// Deprecated: the map is empty until the default client is first used. Use
+// ProviderNames and GetProvider to look providers up and RegisterProvider
+// to add one.
 var Providers = make(map[string]provider)
 
+// builtinsLoaded guards the one-time addition of the built-in providers to
+// Providers.
+var builtinsLoaded sync.Once
+
+// cacheData is the content of a cache file. Provider and SourceURL only
+// describe where the ranges came from; files written before they were added
+// lack them.
 type cacheData struct {
+	Provider  string `json:",omitempty"`
+	SourceURL string `json:",omitempty"`
 	Timestamp int64
 	IPRanges  []string
 }
 
 type cacheManager struct {
 	providerName string
+	// client is the Client the cache belongs to; nil means the default
+	// client.
+	client *Client
+	// static caches hold data that never changes and so never expire.
+	static bool
+
+	mu sync.Mutex
+	// mem holds the data last read from or written to the cache file, so
+	// lookups don't hit the disk; modTime is the file's modification time
+	// after our own last write.
+	mem     *cacheData
+	modTime time.Time
+	index   *rangeIndex
+	// refreshing is set while a background refresh is running.
+	refreshing bool
+	// flight is the refresh that callers join and lastFlight the flight
+	// started last, which may have been abandoned by its callers and still
+	// be stopping.
+	flight, lastFlight *flight
+}
+
+const (
+	defaultCacheTTL  = 7 * 24 * time.Hour
+	defaultCachePerm = 0644
+)
+
+// SetCacheDir sets the directory the default client stores cache files in.
+func SetCacheDir(dir string) {
+	defaultClient.SetCacheDir(dir)
+}
+
+// SetCacheDir sets the directory cache files are stored in. An empty dir
+// selects the user's home directory, which is the default.
+func (cl *Client) SetCacheDir(dir string) {
+	cl.SetOptions(func(c *config) {
+		c.cacheDir = dir
+	})
+}
+
+func (c config) cacheDirPath() (string, error) {
+	if c.cacheDir != "" {
+		return c.cacheDir, nil
+	}
+	return os.UserHomeDir()
+}
+
+// owner returns the Client the cache belongs to.
+func (cm *cacheManager) owner() *Client {
+	if cm.client != nil {
+		return cm.client
+	}
+	return defaultClient
+}
+
+func (cm *cacheManager) config() config {
+	return cm.owner().config()
+}
+
+func (cm *cacheManager) expired(cache cacheData) bool {
+	if cm.static {
+		return false
+	}
+	c := cm.config()
+	ttl, ok := c.providerCacheTTLs[cm.providerName]
+	if !ok {
+		ttl = c.cacheTTL
+	}
+	return time.Since(time.Unix(cache.Timestamp, 0)) > ttl
 }
 
 func (cm *cacheManager) filePath() (string, error) {
-	homeDir, err := os.UserHomeDir()
+	dir, err := cm.config().cacheDirPath()
 	if err != nil {
 		return "", err
 	}
 	fileName := fmt.Sprintf(".%s.cdn.ip.range", cm.providerName)
-	return filepath.Join(homeDir, fileName), nil
+	return filepath.Join(dir, fileName), nil
 }
 
-func (cm *cacheManager) read() ([]string, error) {
+// cacheFileProvider returns the provider name encoded in a cache file name.
+func cacheFileProvider(fileName string) (string, bool) {
+	if !strings.HasPrefix(fileName, ".") || !strings.HasSuffix(fileName, ".cdn.ip.range") {
+		return "", false
+	}
+	name := strings.TrimPrefix(strings.TrimSuffix(fileName, ".cdn.ip.range"), ".")
+	return name, name != ""
+}
+
+func (cm *cacheManager) load() (cacheData, string, error) {
 	var cache cacheData
+	if cm.config().noDiskCache {
+		return cache, "", fs.ErrNotExist
+	}
 	path, err := cm.filePath()
 	if err != nil {
-		return cache.IPRanges, err
+		return cache, path, err
 	}
 	file, err := os.ReadFile(path)
 	if err != nil {
-		return cache.IPRanges, err
+		return cache, path, err
 	}
 	err = json.Unmarshal(file, &cache)
+	return cache, path, err
+}
+
+// current returns the cached data whether or not it has expired. Data read
+// from the cache file goes through normalizeLines like fetched ranges, so
+// that files written by older versions or edited by hand are served in the
+// same form; it fails with ErrCacheCorrupt if too many entries are invalid.
+func (cm *cacheManager) current() (cacheData, error) {
+	cm.mu.Lock()
+	mem := cm.mem
+	cm.mu.Unlock()
+	if mem != nil {
+		return *mem, nil
+	}
+	cache, path, err := cm.load()
+	if errors.Is(err, fs.ErrNotExist) {
+		logger().Debug("cache miss", "provider", cm.providerName, "path", path)
+		return cache, fmt.Errorf("%w: %w", ErrCacheMiss, err)
+	}
+	if err != nil {
+		logger().Warn("cache unreadable", "provider", cm.providerName, "path", path, "error", err)
+		return cache, err
+	}
+	ranges, report := normalizeLines(cache.IPRanges)
+	if report.Invalid > 0 {
+		if report.InvalidFraction() > cm.config().maxInvalidCacheFraction {
+			logger().Warn("cache corrupt", "provider", cm.providerName, "path", path, "invalid", report.Invalid, "valid", report.Valid, "samples", report.Samples)
+			return cacheData{}, fmt.Errorf("%w: %d of %d entries of %s are invalid", ErrCacheCorrupt, report.Invalid, report.Invalid+report.Valid, path)
+		}
+		logger().Warn("dropped invalid cache entries", "provider", cm.providerName, "path", path, "dropped", report.Invalid, "kept", report.Valid, "samples", report.Samples)
+	}
+	cache.IPRanges = ranges
+	cm.mu.Lock()
+	cm.mem = &cache
+	cm.mu.Unlock()
+	return cache, nil
+}
+
+func (cm *cacheManager) read() ([]string, error) {
+	cache, err := cm.current()
 	if err != nil {
 		return cache.IPRanges, err
 	}
-	if time.Now().Unix()-cache.Timestamp > 7*24*60*60 {
-		return cache.IPRanges, fmt.Errorf("cache expired")
+	if cm.expired(cache) {
+		logger().Info("cache expired", "provider", cm.providerName, "written", time.Unix(cache.Timestamp, 0))
+		return cache.IPRanges, fmt.Errorf("%w: %s written %s", ErrCacheExpired, cm.providerName, time.Unix(cache.Timestamp, 0))
 	}
+	logger().Debug("cache hit", "provider", cm.providerName, "count", len(cache.IPRanges))
 	return cache.IPRanges, nil
 }
 
-func (cm *cacheManager) write(data []string) error {
+func (cm *cacheManager) write(data []string, sourceURL string) error {
+	return cm.store(cacheData{
+		Provider:  cm.providerName,
+		SourceURL: sourceURL,
+		Timestamp: time.Now().Unix(),
+		IPRanges:  data,
+	})
+}
+
+// store writes cache to the cache file, or only keeps it in memory if the
+// disk cache is disabled. It refuses data without a single valid range,
+// which would otherwise be served until it expires.
+func (cm *cacheManager) store(cache cacheData) error {
+	if !hasValidRange(cache.IPRanges) {
+		return fmt.Errorf("%w: not caching %s", ErrNoValidRanges, cm.providerName)
+	}
+	if cm.config().noDiskCache {
+		cm.mu.Lock()
+		cm.mem = &cache
+		cm.index = nil
+		cm.mu.Unlock()
+		cm.stored(cache)
+		return nil
+	}
 	path, err := cm.filePath()
 	if err != nil {
 		return err
 	}
-	cache := cacheData{
-		Timestamp: time.Now().Unix(),
-		IPRanges:  data,
+	perm := cm.config().cachePerm
+	if perm == 0 {
+		perm = defaultCachePerm
+	}
+	if err = os.MkdirAll(filepath.Dir(path), perm|(perm&0444)>>2); err != nil {
+		return err
 	}
 	file, err := json.MarshalIndent(cache, "", " ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, file, 0644)
+	if err = os.WriteFile(path, file, perm); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file.
+	if err = os.Chmod(path, perm); err != nil {
+		return err
+	}
+	cm.mu.Lock()
+	cm.mem = &cache
+	cm.index = nil
+	if info, err := os.Stat(path); err == nil {
+		cm.modTime = info.ModTime()
+	}
+	cm.mu.Unlock()
+	cm.stored(cache)
+	return nil
+}
+
+// stored invalidates cached lookups and records cache in the history after
+// a store.
+func (cm *cacheManager) stored(cache cacheData) {
+	cm.owner().lookups.clear()
+	if h := cm.config().history; h != nil {
+		if err := h.append(cm.providerName, cache); err != nil {
+			logger().Warn("history not written", "provider", cm.providerName, "error", err)
+		}
+	}
+}
+
+func (cm *cacheManager) evict() {
+	cm.mu.Lock()
+	cm.mem = nil
+	cm.index = nil
+	cm.mu.Unlock()
+	cm.owner().lookups.clear()
+}
+
+// changedExternally reports whether the cache file at path is not the one
+// this manager last wrote.
+func (cm *cacheManager) changedExternally(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return true
+	}
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return !info.ModTime().Equal(cm.modTime)
 }
 
 func newCacheManager(providerName string) *cacheManager {
@@ -93,370 +373,2083 @@ func newCacheManager(providerName string) *cacheManager {
 }
 
 type defaultProvider struct {
-	cache *cacheManager
+	name string
+	url  string
+	// fallbackURL, if set, is requested instead of url when a request to
+	// url fails.
+	fallbackURL string
+	cache       *cacheManager
+	client      *Client
+	// maxBodySize overrides defaultMaxResponseSize for providers with
+	// unusually large responses.
+	maxBodySize int64
+	// minRanges is the fewest entries a fetch may yield before it is taken
+	// for a broken response rather than a shrunken list.
+	minRanges int
+	// ctx is the context of the provider's requests, set by withContext on
+	// the copy a refresh fetches with; nil means context.Background.
+	ctx context.Context
 }
 
-func (dp defaultProvider) processLines(lines []string) []string {
-	var result []string
-	for _, line := range lines {
-		if line == "" {
-			continue
-		}
-		line = strings.Trim(line, "\r\t ")
-		result = append(result, line)
+// splitLines splits a text list into lines, accepting both LF and CRLF line
+// endings.
+func splitLines(body string) []string {
+	return strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n")
+}
+
+// processLines trims spaces, tabs and a byte order mark from the entries of
+// a fetched list, split by splitLines, skips blank lines and comment lines
+// starting with # or ;, and drops entries that are neither a CIDR nor an IP
+// address, such as headers or stray markup, logging how many were dropped
+// and recording a ParseReport in the provider's stats. The rest is rewritten in
+// canonical form, e.g. 2001:db8::/32 for 2001:0DB8:0:0::/32, sorted by
+// compareNets, so that the cache doesn't change with the source's order,
+// and entries denoting the same range are kept once. It fails if nothing
+// valid is left.
+func (dp defaultProvider) processLines(lines []string) ([]string, error) {
+	result, report := normalizeLines(lines)
+	dp.owner().recordParse(dp.name, report)
+	if report.Invalid > 0 {
+		logger().Warn("dropped invalid entries", "provider", dp.name, "dropped", report.Invalid, "kept", report.Valid, "samples", report.Samples)
 	}
-	return result
+	if len(result) == 0 {
+		return nil, &FetchError{Provider: dp.name, URL: dp.url, Err: ErrNoValidRanges}
+	}
+	return result, nil
 }
 
-func (dp defaultProvider) FetchIPRangesWithCache(p provider) ([]string, error) {
-	lines, err := dp.cache.read()
-	if len(lines) > 0 && err == nil {
-		return lines, nil
-	} else {
-		ipRanges, err := p.FetchIPRanges()
-		if err != nil {
-			return nil, err
+// normalizeLines does the work of processLines, returning what is left and
+// a report of the entries it dropped.
+func normalizeLines(lines []string) ([]string, ParseReport) {
+	type entry struct {
+		text string
+		cidr *net.IPNet
+	}
+	var (
+		entries []entry
+		report  ParseReport
+	)
+	for _, line := range lines {
+		line = strings.Trim(strings.TrimPrefix(line, "\ufeff"), "\t ")
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
 		}
-		if len(ipRanges) > 0 {
-			err = dp.cache.write(ipRanges)
-			if err != nil {
-				return nil, err
+		cidr := parseRange(line)
+		if cidr == nil {
+			report.Invalid++
+			if len(report.Samples) < maxParseSamples {
+				report.Samples = append(report.Samples, line)
 			}
+			continue
+		}
+		text := cidr.String()
+		if !strings.Contains(line, "/") {
+			text = cidr.IP.String()
+		}
+		entries = append(entries, entry{text, cidr})
+	}
+	report.Valid = len(entries)
+	slices.SortStableFunc(entries, func(a, b entry) int {
+		return compareNets(a.cidr, b.cidr)
+	})
+	result := make([]string, 0, len(entries))
+	for i, e := range entries {
+		if i == 0 || compareNets(entries[i-1].cidr, e.cidr) != 0 {
+			result = append(result, e.text)
 		}
-		return ipRanges, nil
 	}
+	return result, report
 }
 
-type akamai struct{ defaultProvider }
-
-func (a akamai) FetchIPRanges() ([]string, error) {
-	var result []string
-	req, err := http.NewRequest("GET", "https://techdocs.akamai.com/origin-ip-acl/docs/update-your-origin-server", nil)
-	if err != nil {
-		return result, err
-	}
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/58.0.3029.110 Safari/537.3")
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return result, err
-	}
-	defer resp.Body.Close()
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
-	if err != nil {
-		return result, err
+// owner returns the Client the provider belongs to.
+func (dp defaultProvider) owner() *Client {
+	if dp.client != nil {
+		return dp.client
 	}
-	ips := doc.Find(".rdmd-code").Eq(0).Text()
-	result = strings.Split(ips, "\n")
-	result = a.processLines(result)
-	return result, nil
+	return defaultClient
 }
 
-func newAkamai() *akamai {
-	return &akamai{defaultProvider: defaultProvider{
-		cache: newCacheManager(Akamai),
-	}}
+func (dp *defaultProvider) bind(cl *Client) {
+	dp.client = cl
+	dp.cache.client = cl
 }
 
-type bunny struct{ defaultProvider }
+func (dp defaultProvider) cacheStore() *cacheManager {
+	return dp.cache
+}
 
-func (b bunny) FetchIPRanges() ([]string, error) {
-	var result []string
-	resp, err := http.Get("https://api.bunny.net/system/edgeserverlist/plain")
-	if err != nil {
-		return result, err
-	}
-	defer resp.Body.Close()
-	bs, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return result, err
+func cacheOf(p provider) *cacheManager {
+	if cs, ok := p.(interface{ cacheStore() *cacheManager }); ok {
+		return cs.cacheStore()
 	}
-	result = strings.Split(string(bs), "\n")
-	result = b.processLines(result)
-	return result, nil
+	return nil
 }
 
-func newBunny() *bunny {
-	return &bunny{defaultProvider: defaultProvider{
-		cache: newCacheManager(Bunny),
-	}}
+func (dp defaultProvider) sourceURL() string {
+	return dp.url
 }
 
-type cacheFly struct{ defaultProvider }
+func (dp *defaultProvider) setURL(url string) {
+	dp.url = url
+}
 
-func (c cacheFly) FetchIPRanges() ([]string, error) {
-	var result []string
-	resp, err := http.Get("https://cachefly.cachefly.net/ips/cdn.txt")
+func (dp defaultProvider) fallbackSourceURL() string {
+	return dp.fallbackURL
+}
+
+func (dp *defaultProvider) setFallbackURL(url string) {
+	dp.fallbackURL = url
+}
+
+// get requests url, falling back to the provider's fallback URL if url is
+// its primary source and doesn't respond with a success status.
+func (dp defaultProvider) get(url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(dp.fetchContext(), "GET", url, nil)
 	if err != nil {
-		return result, err
+		return nil, err
+	}
+	resp, err := dp.do(req)
+	if err != nil && url == dp.url && dp.fallbackURL != "" && dp.fallbackURL != url {
+		logger().Warn("primary source failed, trying fallback", "provider", dp.name, "url", dp.fallbackURL, "error", err)
+		fallback, fallbackErr := dp.get(dp.fallbackURL)
+		if fallbackErr != nil {
+			return nil, errors.Join(err, fallbackErr)
+		}
+		return fallback, nil
+	}
+	return resp, err
+}
+
+// getText returns the body of a plain-text list, failing with
+// ErrUnexpectedFormat, and ErrNoValidRanges, if it is an HTML page instead,
+// such as a challenge or maintenance page served with status 200 by the CDN
+// in front of the source.
+func (dp defaultProvider) getText(url string) (string, error) {
+	resp, err := dp.get(url)
+	if err != nil {
+		return "", err
 	}
 	defer resp.Body.Close()
 	bs, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return result, err
+		return "", err
 	}
-	result = strings.Split(string(bs), "\n")
-	result = c.processLines(result)
-	return result, nil
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/html" || http.DetectContentType(bs) == "text/html; charset=utf-8" {
+		return "", &FetchError{Provider: dp.name, URL: url, Err: fmt.Errorf("%w, %w: got an HTML page instead of a list", ErrUnexpectedFormat, ErrNoValidRanges)}
+	}
+	return string(bs), nil
 }
 
-func newCacheFly() *cacheFly {
-	return &cacheFly{defaultProvider: defaultProvider{
-		cache: newCacheManager(CacheFly),
-	}}
+func (dp defaultProvider) do(req *http.Request) (*http.Response, error) {
+	cl := dp.owner()
+	c := cl.config()
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	if lim := cl.limiter(dp.name, req.URL); lim != nil {
+		if err := lim.Wait(req.Context()); err != nil {
+			return nil, &FetchError{Provider: dp.name, URL: req.URL.String(), Err: err}
+		}
+	}
+	var cancel context.CancelFunc
+	if d := c.requestTimeouts[dp.name]; d > 0 {
+		var ctx context.Context
+		ctx, cancel = context.WithTimeout(req.Context(), d)
+		req = req.WithContext(ctx)
+	}
+	resp, err := cl.httpClient(dp.name).Do(req)
+	if err != nil {
+		if cancel != nil {
+			cancel()
+		}
+		return nil, &FetchError{Provider: dp.name, URL: req.URL.String(), Err: err}
+	}
+	if cancel != nil {
+		resp.Body = cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, errorBodySnippet))
+		return nil, &FetchError{
+			Provider:   dp.name,
+			URL:        req.URL.String(),
+			StatusCode: resp.StatusCode,
+			Err:        fmt.Errorf("unexpected status %s: %q", resp.Status, strings.TrimSpace(string(body))),
+		}
+	}
+	resp.Body = dp.limitBody(resp.Body, req.URL.String(), c)
+	return resp, nil
 }
 
-type cloudFlare struct{ defaultProvider }
+// limitBody wraps body so that reading more than the allowed response size
+// fails.
+func (dp defaultProvider) limitBody(body io.ReadCloser, url string, c config) io.ReadCloser {
+	limit := c.maxResponseSize
+	if limit <= 0 {
+		limit = dp.maxBodySize
+	}
+	if limit <= 0 {
+		limit = defaultMaxResponseSize
+	}
+	return &limitedBody{ReadCloser: body, url: url, limit: limit, remaining: limit}
+}
 
-func (c cloudFlare) FetchIPRanges() ([]string, error) {
-	var result []string
-	resp, err := http.Get("https://www.cloudflare.com/ips-v4")
-	if err != nil {
-		return result, err
+// findElements returns the elements below n for which match reports true.
+// The descendants of a matching element are not searched, so that nested
+// matches such as <pre><code> don't yield the same text twice.
+func findElements(n *html.Node, match func(*html.Node) bool) []*html.Node {
+	if n.Type == html.ElementNode && match(n) {
+		return []*html.Node{n}
 	}
-	defer resp.Body.Close()
-	bs, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return result, err
+	var result []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		result = append(result, findElements(c, match)...)
 	}
-	result = strings.Split(string(bs), "\n")
-	result = c.processLines(result)
-	return result, nil
+	return result
 }
 
-func newCloudFlare() *cloudFlare {
-	return &cloudFlare{defaultProvider: defaultProvider{
-		cache: newCacheManager(CloudFlare),
-	}}
+// hasClass reports whether the element n has class among its classes.
+func hasClass(n *html.Node, class string) bool {
+	for _, attr := range n.Attr {
+		if attr.Key == "class" && slices.Contains(strings.Fields(attr.Val), class) {
+			return true
+		}
+	}
+	return false
 }
 
-type cloudFront struct{ defaultProvider }
+// isElement returns a matcher for findElements that accepts elements with
+// any of the given tag names.
+func isElement(tags ...string) func(*html.Node) bool {
+	return func(n *html.Node) bool {
+		return slices.Contains(tags, n.Data)
+	}
+}
 
-func (c cloudFront) FetchIPRanges() ([]string, error) {
+// nodesText returns the text nodes within nodes one per line, so that the
+// contents of adjacent elements don't run together.
+func nodesText(nodes []*html.Node) string {
 	var (
-		result []string
-		data   = make(map[string][]string)
+		b    strings.Builder
+		walk func(*html.Node)
 	)
-	resp, err := http.Get("https://d7uri8nf7uskq.cloudfront.net/tools/list-cloudfront-ips")
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			b.WriteByte('\n')
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+	return b.String()
+}
+
+// scrapeRanges fetches the HTML page at the provider's URL and returns the
+// ranges in the elements match accepts. Only the elements that hold the
+// list are searched, as addresses elsewhere on a page, in examples or a
+// footer, aren't the provider's; if the layout changes so that none match,
+// processLines fails instead of caching whatever else the page mentions.
+func (dp defaultProvider) scrapeRanges(match func(*html.Node) bool) ([]string, error) {
+	resp, err := dp.get(dp.url)
 	if err != nil {
-		return result, err
+		return nil, err
 	}
 	defer resp.Body.Close()
-	err = json.NewDecoder(resp.Body).Decode(&data)
+	doc, err := html.Parse(resp.Body)
 	if err != nil {
-		return result, err
+		return nil, err
 	}
-	result = data["CLOUDFRONT_GLOBAL_IP_LIST"]
-	result = c.processLines(result)
-	return result, nil
-}
-
-func newCloudFront() *cloudFront {
-	return &cloudFront{defaultProvider: defaultProvider{
-		cache: newCacheManager(CloudFront),
-	}}
-}
-
-type fastly struct {
-	defaultProvider
-	Addresses []string
+	return dp.processLines(extractRanges(nodesText(findElements(doc, match))))
 }
 
-func (f fastly) FetchIPRanges() ([]string, error) {
-	var result []string
-	resp, err := http.Get("https://api.fastly.com/public-ip-list")
+// decodeJSON decodes the JSON object read from r into v after checking that
+// it has each of the required keys, so that a renamed key fails instead of
+// decoding as an empty list. Other keys are allowed, since providers add
+// new ones over time.
+func decodeJSON(r io.Reader, v any, required ...string) error {
+	bs, err := io.ReadAll(r)
 	if err != nil {
-		return result, err
+		return err
 	}
-	defer resp.Body.Close()
-	err = json.NewDecoder(resp.Body).Decode(&f)
-	if err != nil {
-		return result, err
+	var keys map[string]json.RawMessage
+	if err = json.Unmarshal(bs, &keys); err != nil {
+		return err
 	}
-	result = f.processLines(f.Addresses)
-	return result, nil
+	for _, key := range required {
+		if _, ok := keys[key]; !ok {
+			return fmt.Errorf("%w: no %q key", ErrUnexpectedFormat, key)
+		}
+	}
+	return json.Unmarshal(bs, v)
 }
 
-func newFastly() *fastly {
-	return &fastly{defaultProvider: defaultProvider{
-		cache: newCacheManager(Fastly),
-	}}
+// extractRanges returns the tokens of text that are IP addresses or CIDRs,
+// for providers that only publish their ranges inside prose or markup.
+func extractRanges(text string) []string {
+	var result []string
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(",;()<>\"'", r)
+	})
+	for _, field := range fields {
+		if _, _, err := net.ParseCIDR(field); err == nil || net.ParseIP(field) != nil {
+			result = append(result, field)
+		}
+	}
+	return result
 }
 
-type google struct {
-	defaultProvider
-	Prefixes []struct {
-		IPv4Prefix string
+// fetchWithCache implements FetchIPRangesWithCache for the providers that
+// embed defaultProvider, with self being the embedding provider, whose
+// FetchIPRanges does the fetching.
+func (dp defaultProvider) fetchWithCache(ctx context.Context, self provider) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
+	return dp.cachedOrFetch(ctx, self)
 }
 
-func (g google) FetchIPRanges() ([]string, error) {
-	var result []string
-	r := &http.Client{}
-	req, err := http.NewRequest("GET", "https://www.gstatic.com/ipranges/cloud.json", nil)
-	if err != nil {
-		return result, err
+// cachedOrFetch returns the cached ranges, fetching them with self if the
+// cache is missing or expired. If the fetch fails, expired ranges are served
+// rather than none, and failing those the ranges of the fallback FS, so that
+// a host that boots offline still has something to match against.
+func (dp defaultProvider) cachedOrFetch(ctx context.Context, self provider) ([]string, error) {
+	lines, err := dp.cache.read()
+	if len(lines) > 0 && err == nil {
+		observeCache(dp.name, true)
+		return lines, nil
+	} else if len(lines) > 0 && errors.Is(err, ErrCacheExpired) && dp.owner().config().staleWhileRevalidate {
+		observeCache(dp.name, true)
+		dp.revalidate(self)
+		return lines, nil
+	} else {
+		observeCache(dp.name, false)
+		ipRanges, fetchErr := dp.refresh(ctx, self)
+		if fetchErr == nil {
+			return ipRanges, nil
+		}
+		if len(lines) > 0 && errors.Is(err, ErrCacheExpired) {
+			logger().Warn("serving expired ranges", "provider", dp.name, "count", len(lines), "error", fetchErr)
+			return lines, nil
+		}
+		if fallback, err := dp.fallback(); err == nil {
+			logger().Warn("serving fallback ranges", "provider", dp.name, "count", len(fallback), "error", fetchErr)
+			return fallback, nil
+		}
+		return ipRanges, fetchErr
 	}
-	resp, err := r.Do(req)
-	if err != nil {
-		return result, err
+}
+
+// fallback reads the provider's baseline ranges from the FS set with
+// WithFallbackFS.
+func (dp defaultProvider) fallback() ([]string, error) {
+	fsys := dp.owner().config().fallbackFS
+	if fsys == nil {
+		return nil, fs.ErrNotExist
 	}
-	defer resp.Body.Close()
-	err = json.NewDecoder(resp.Body).Decode(&g)
+	data, err := fs.ReadFile(fsys, dp.name+".txt")
 	if err != nil {
-		return result, err
+		return nil, err
 	}
-	for _, item := range g.Prefixes {
-		result = append(result, item.IPv4Prefix)
+	ipRanges, _ := normalizeLines(splitLines(string(data)))
+	if len(ipRanges) == 0 {
+		return nil, fmt.Errorf("%w: fallback of %s", ErrNoValidRanges, dp.name)
 	}
-	result = g.processLines(result)
-	return result, nil
+	return ipRanges, nil
 }
 
-func newGoogle() *google {
-	return &google{defaultProvider: defaultProvider{
-		cache: newCacheManager(Google),
-	}}
+// A flight is a fetch of a provider's ranges, such as a refresh of its cache
+// shared by the callers waiting for it. Its context is cancelled once all of
+// them have given up, which stops the provider's requests.
+type flight struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	waiters  int
+	done     chan struct{}
+	ipRanges []string
+	err      error
 }
 
-type gCore struct {
-	defaultProvider
-	Addresses []string
+// refresh fetches the ranges into the cache with p, joining a refresh of the
+// same provider that is already running. It returns early with ctx's error
+// when ctx is done, and the refresh is cancelled if no other caller is
+// waiting for it.
+func (dp defaultProvider) refresh(ctx context.Context, p provider) ([]string, error) {
+	cm := dp.cache
+	cm.mu.Lock()
+	f := cm.flight
+	if f == nil {
+		f = dp.startFlight(func(ctx context.Context) ([]string, error) {
+			return dp.fetchAndCache(withContext(p, ctx))
+		})
+		cm.flight = f
+	}
+	f.waiters++
+	cm.mu.Unlock()
+	return dp.wait(ctx, f)
 }
 
-func (g gCore) FetchIPRanges() ([]string, error) {
-	var result []string
-	resp, err := http.Get("https://api.gcore.com/cdn/public-ip-list")
+// wait returns the result of f, or ctx's error when ctx is done first, in
+// which case f is cancelled if no other caller is waiting for it.
+func (dp defaultProvider) wait(ctx context.Context, f *flight) ([]string, error) {
+	cm := dp.cache
+	select {
+	case <-f.done:
+		return f.ipRanges, f.err
+	case <-ctx.Done():
+		cm.mu.Lock()
+		if f.waiters--; f.waiters == 0 {
+			f.cancel()
+			if cm.flight == f {
+				cm.flight = nil
+			}
+		}
+		cm.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// startFlight starts a flight running fetch with the flight's context, after
+// the previous one has finished, so that one flight at most runs at a time.
+// It must be called with the cache's mutex held.
+func (dp defaultProvider) startFlight(fetch func(context.Context) ([]string, error)) *flight {
+	cm := dp.cache
+	ctx, cancel := context.WithCancel(context.Background())
+	f := &flight{ctx: ctx, cancel: cancel, done: make(chan struct{})}
+	prev := cm.lastFlight
+	cm.lastFlight = f
+	go func() {
+		if prev != nil {
+			<-prev.done
+		}
+		f.ipRanges, f.err = fetch(ctx)
+		cm.mu.Lock()
+		if cm.flight == f {
+			cm.flight = nil
+		}
+		cm.mu.Unlock()
+		cancel()
+		close(f.done)
+	}()
+	return f
+}
+
+// fetchContext returns the context for the provider's requests: that of the
+// refresh fetching with this copy of the provider, if any, and otherwise
+// context.Background.
+func (dp defaultProvider) fetchContext() context.Context {
+	if dp.ctx != nil {
+		return dp.ctx
+	}
+	return context.Background()
+}
+
+// revalidate refreshes the cache in the background unless a refresh is
+// already running.
+func (dp defaultProvider) revalidate(p provider) {
+	dp.cache.mu.Lock()
+	defer dp.cache.mu.Unlock()
+	if dp.cache.refreshing {
+		return
+	}
+	dp.cache.refreshing = true
+	go func() {
+		if _, err := dp.refresh(context.Background(), p); err != nil {
+			logger().Warn("background refresh failed", "provider", dp.name, "error", err)
+		}
+		dp.cache.mu.Lock()
+		dp.cache.refreshing = false
+		dp.cache.mu.Unlock()
+	}()
+}
+
+// minCount returns the fewest ranges a fetch must yield to be cached.
+func (dp defaultProvider) minCount() int {
+	if n, ok := dp.owner().config().minRanges[dp.name]; ok {
+		return n
+	}
+	return dp.minRanges
+}
+
+func (dp defaultProvider) fetchAndCache(p provider) (ipRanges []string, err error) {
+	defer func() {
+		dp.owner().recordFetch(dp.name, err)
+	}()
+	logger().Debug("fetch start", "provider", dp.name, "url", dp.url)
+	start := time.Now()
+	ipRanges, err = dp.fetchChecked(p)
+	metrics().ObserveFetch(dp.name, time.Since(start), err)
+	if err != nil {
+		logger().Warn("fetch failed", "provider", dp.name, "url", dp.url, "duration", time.Since(start), "error", err)
+		return nil, err
+	}
+	logger().Info("fetch finish", "provider", dp.name, "url", dp.url, "duration", time.Since(start), "count", len(ipRanges))
+	if validate := dp.owner().config().validate; validate != nil {
+		if err = validate(dp.name, ipRanges); err != nil {
+			logger().Warn("fetched ranges rejected", "provider", dp.name, "url", dp.url, "error", err)
+			return nil, fmt.Errorf("%s: %w", dp.name, err)
+		}
+	}
+	previous, prevErr := dp.cache.current()
+	err = dp.cache.write(ipRanges, dp.url)
+	if err != nil {
+		logger().Error("cache write failed", "provider", dp.name, "error", err)
+		return nil, err
+	}
+	if prevErr == nil {
+		dp.owner().notifyChange(dp.name, previous.IPRanges, ipRanges)
+	}
+	return ipRanges, nil
+}
+
+// fetchChecked fetches the ranges with p and fails with a FetchError unless
+// there are enough valid ones.
+func (dp defaultProvider) fetchChecked(p provider) ([]string, error) {
+	ipRanges, err := p.FetchIPRanges()
+	var fetchErr *FetchError
+	if err != nil && !errors.As(err, &fetchErr) {
+		err = &FetchError{Provider: dp.name, URL: dp.url, Err: err}
+	}
+	if err == nil && !hasValidRange(ipRanges) {
+		err = &FetchError{Provider: dp.name, URL: dp.url, Err: ErrNoValidRanges}
+	}
+	if min := dp.minCount(); err == nil && len(ipRanges) < min {
+		err = &FetchError{Provider: dp.name, URL: dp.url, Err: fmt.Errorf("%w: got %d, want at least %d", ErrTooFewRanges, len(ipRanges), min)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ipRanges, nil
+}
+
+type akamai struct{ defaultProvider }
+
+// FetchIPRanges reads the ranges from Akamai's API if a token is set with
+// SetAkamaiAPIToken and otherwise scans the documentation page for them.
+// On the page, the code blocks of the current layout are tried first, then
+// any code block and finally all of the page's text, so that a change of
+// theme doesn't lose the list.
+func (a akamai) FetchIPRanges() ([]string, error) {
+	if c := a.owner().config(); c.akamaiAPIToken != "" {
+		return a.fetchAPI(c.akamaiAPIURL, c.akamaiAPIToken)
+	}
+	var result []string
+	req, err := http.NewRequestWithContext(a.fetchContext(), "GET", a.url, nil)
+	if err != nil {
+		return result, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/58.0.3029.110 Safari/537.3")
+	resp, err := a.do(req)
 	if err != nil {
 		return result, err
 	}
 	defer resp.Body.Close()
-	err = json.NewDecoder(resp.Body).Decode(&g)
+	doc, err := html.Parse(resp.Body)
 	if err != nil {
 		return result, err
 	}
-	result = g.processLines(g.Addresses)
-	return result, nil
+	for _, match := range []func(*html.Node) bool{
+		func(n *html.Node) bool { return hasClass(n, "rdmd-code") },
+		isElement("pre", "code"),
+		isElement("body"),
+	} {
+		if result = extractRanges(nodesText(findElements(doc, match))); len(result) > 0 {
+			break
+		}
+	}
+	return a.processLines(result)
+}
+
+func (a akamai) FetchIPRangesWithCache(ctx context.Context) ([]string, error) {
+	return a.fetchWithCache(ctx, a)
+}
+
+func (a akamai) withContext(ctx context.Context) provider {
+	a.ctx = ctx
+	return a
+}
+
+// fetchAPI reads the CIDR blocks listed by the Firewall Rules Manager API,
+// leaving out those Akamai is about to remove.
+func (a akamai) fetchAPI(apiURL, token string) ([]string, error) {
+	req, err := http.NewRequestWithContext(a.fetchContext(), "GET", apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := a.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var blocks []struct {
+		CIDR       string `json:"cidr"`
+		CIDRMask   string `json:"cidrMask"`
+		LastAction string `json:"lastAction"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&blocks); err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, block := range blocks {
+		if block.LastAction == "delete" {
+			continue
+		}
+		result = append(result, block.CIDR+"/"+strings.TrimPrefix(block.CIDRMask, "/"))
+	}
+	return a.processLines(result)
+}
+
+// SetAkamaiAPIToken makes the default client's akamai provider use Akamai's
+// API; see Client.SetAkamaiAPIToken.
+func SetAkamaiAPIToken(apiURL, token string) error {
+	return defaultClient.SetAkamaiAPIToken(apiURL, token)
+}
+
+// SetAkamaiAPIToken makes the akamai provider read the ranges from the
+// cidr-blocks endpoint of Akamai's Firewall Rules Manager API at apiURL,
+// which is specific to each account, e.g.
+// https://akab-xxxx.luna.akamaiapis.net/firewall-rules-manager/v1/cidr-blocks,
+// sending token as a bearer token, instead of scraping the documentation
+// page. An empty token restores scraping. Ranges that are already cached
+// are used until they expire.
+func (cl *Client) SetAkamaiAPIToken(apiURL, token string) error {
+	if token != "" {
+		if err := cl.validateSourceURL(apiURL); err != nil {
+			return err
+		}
+	}
+	cl.SetOptions(func(c *config) {
+		c.akamaiAPIURL = apiURL
+		c.akamaiAPIToken = token
+	})
+	return nil
+}
+
+func newAkamai() *akamai {
+	return &akamai{defaultProvider: defaultProvider{
+		name:  Akamai,
+		url:   "https://techdocs.akamai.com/origin-ip-acl/docs/update-your-origin-server",
+		cache: newCacheManager(Akamai),
+	}}
+}
+
+// bunny reads the plain edge server list. Bunny's other lists, such as
+// edgeserverlist in JSON, are the same flat list of addresses, and its
+// region API has no addresses, so there is no region to report per edge.
+type bunny struct{ defaultProvider }
+
+func (b bunny) FetchIPRanges() ([]string, error) {
+	body, err := b.getText(b.url)
+	if err != nil {
+		return nil, err
+	}
+	return b.processLines(splitLines(body))
+}
+
+func (b bunny) FetchIPRangesWithCache(ctx context.Context) ([]string, error) {
+	return b.fetchWithCache(ctx, b)
+}
+
+func (b bunny) withContext(ctx context.Context) provider {
+	b.ctx = ctx
+	return b
+}
+
+func newBunny() *bunny {
+	return &bunny{defaultProvider: defaultProvider{
+		name:      Bunny,
+		url:       "https://api.bunny.net/system/edgeserverlist/plain",
+		cache:     newCacheManager(Bunny),
+		minRanges: 50,
+	}}
+}
+
+type cacheFly struct{ defaultProvider }
+
+func (c cacheFly) FetchIPRanges() ([]string, error) {
+	body, err := c.getText(c.url)
+	if err != nil {
+		return nil, err
+	}
+	return c.processLines(splitLines(body))
+}
+
+func (c cacheFly) FetchIPRangesWithCache(ctx context.Context) ([]string, error) {
+	return c.fetchWithCache(ctx, c)
+}
+
+func (c cacheFly) withContext(ctx context.Context) provider {
+	c.ctx = ctx
+	return c
+}
+
+func newCacheFly() *cacheFly {
+	return &cacheFly{defaultProvider: defaultProvider{
+		name:  CacheFly,
+		url:   "https://cachefly.cachefly.net/ips/cdn.txt",
+		cache: newCacheManager(CacheFly),
+	}}
+}
+
+type cloudFlare struct{ defaultProvider }
+
+func (c cloudFlare) FetchIPRanges() ([]string, error) {
+	body, err := c.getText(c.url)
+	if err != nil {
+		return nil, err
+	}
+	return c.processLines(splitLines(body))
+}
+
+func (c cloudFlare) FetchIPRangesWithCache(ctx context.Context) ([]string, error) {
+	return c.fetchWithCache(ctx, c)
+}
+
+func (c cloudFlare) withContext(ctx context.Context) provider {
+	c.ctx = ctx
+	return c
+}
+
+func newCloudFlare() *cloudFlare {
+	return &cloudFlare{defaultProvider: defaultProvider{
+		name:      CloudFlare,
+		url:       "https://www.cloudflare.com/ips-v4",
+		cache:     newCacheManager(CloudFlare),
+		minRanges: 10,
+	}}
+}
+
+type cloudFlareAccess struct{ defaultProvider }
+
+// configured reports whether a list was set with SetProviderURL, as
+// Cloudflare publishes none of its own.
+func (c cloudFlareAccess) configured() bool {
+	return c.url != ""
+}
+
+// FetchIPRanges reads either a plain list, one range per line, or a
+// response in the format of Cloudflare's API at /client/v4/ips.
+func (c cloudFlareAccess) FetchIPRanges() ([]string, error) {
+	if c.url == "" {
+		return nil, &FetchError{Provider: c.name, Err: fmt.Errorf("%w: no list configured, set one with SetProviderURL", ErrNoValidRanges)}
+	}
+	body, err := c.getText(c.url)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(strings.TrimSpace(body), "{") {
+		return c.processLines(splitLines(body))
+	}
+	var data struct {
+		Result struct {
+			IPv4CIDRs []string `json:"ipv4_cidrs"`
+			IPv6CIDRs []string `json:"ipv6_cidrs"`
+		} `json:"result"`
+	}
+	if err = json.Unmarshal([]byte(body), &data); err != nil {
+		return nil, err
+	}
+	return c.processLines(append(data.Result.IPv4CIDRs, data.Result.IPv6CIDRs...))
+}
+
+func (c cloudFlareAccess) FetchIPRangesWithCache(ctx context.Context) ([]string, error) {
+	return c.fetchWithCache(ctx, c)
+}
+
+func (c cloudFlareAccess) withContext(ctx context.Context) provider {
+	c.ctx = ctx
+	return c
+}
+
+func newCloudFlareAccess() *cloudFlareAccess {
+	return &cloudFlareAccess{defaultProvider: defaultProvider{
+		name:  CloudFlareAccess,
+		cache: newCacheManager(CloudFlareAccess),
+	}}
+}
+
+type cloudFlareWarp struct{ defaultProvider }
+
+// FetchIPRanges scrapes the code blocks of Cloudflare's WARP documentation,
+// as there is no machine-readable list of WARP egress ranges. Prose on the
+// page, which also mentions other addresses such as resolvers, is ignored.
+func (c cloudFlareWarp) FetchIPRanges() ([]string, error) {
+	return c.scrapeRanges(isElement("code"))
+}
+
+func (c cloudFlareWarp) FetchIPRangesWithCache(ctx context.Context) ([]string, error) {
+	return c.fetchWithCache(ctx, c)
+}
+
+func (c cloudFlareWarp) withContext(ctx context.Context) provider {
+	c.ctx = ctx
+	return c
+}
+
+func newCloudFlareWarp() *cloudFlareWarp {
+	return &cloudFlareWarp{defaultProvider: defaultProvider{
+		name:  CloudFlareWarp,
+		url:   "https://developers.cloudflare.com/cloudflare-one/connections/connect-devices/warp/deployment/firewall/",
+		cache: newCacheManager(CloudFlareWarp),
+	}}
+}
+
+// Keys of the lists published by the CloudFront IP list endpoint. The
+// IPv6 ranges of a list, where published, are under the same key with
+// cloudFrontIPv6Suffix appended, e.g. CLOUDFRONT_GLOBAL_IP_LIST_IPV6, and
+// are always included along with the list.
+const (
+	CloudFrontGlobalIPList       = "CLOUDFRONT_GLOBAL_IP_LIST"
+	CloudFrontRegionalEdgeIPList = "CLOUDFRONT_REGIONAL_EDGE_IP_LIST"
+	CloudFrontOriginFacingIPList = "CLOUDFRONT_ORIGIN_FACING_IP_LIST"
+
+	cloudFrontIPv6Suffix = "_IPV6"
+)
+
+// sharedFetchTimeout bounds a request shared by several fetches when no
+// fetch timeout is set.
+const sharedFetchTimeout = time.Minute
+
+type cloudFront struct{ defaultProvider }
+
+func (c cloudFront) FetchIPRanges() ([]string, error) {
+	lists := c.owner().config().cloudFrontIPLists
+	if len(lists) == 0 {
+		lists = []string{CloudFrontGlobalIPList, CloudFrontRegionalEdgeIPList}
+	}
+	return c.fetchLists(lists)
+}
+
+func (c cloudFront) FetchIPRangesWithCache(ctx context.Context) ([]string, error) {
+	return c.fetchWithCache(ctx, c)
+}
+
+func (c cloudFront) withContext(ctx context.Context) provider {
+	c.ctx = ctx
+	return c
+}
+
+func (c cloudFront) fetchLists(lists []string) ([]string, error) {
+	data, err := c.fetchAll()
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, list := range lists {
+		if _, ok := data[list]; !ok {
+			return nil, &FetchError{Provider: c.name, URL: c.url, Err: fmt.Errorf("%w: no %q key", ErrUnexpectedFormat, list)}
+		}
+		result = append(result, data[list]...)
+		result = append(result, data[list+cloudFrontIPv6Suffix]...)
+	}
+	return c.processLines(result)
+}
+
+// fetchAll returns every list of the CloudFront endpoint. Fetches of the
+// same URL running at the same time, such as those of cloudfront and
+// cloudfront-regional during PreCache, share one request. As no caller owns
+// it, the request isn't cancelled with the caller that started it but is
+// bounded by the fetch timeout, or sharedFetchTimeout if none is set; each
+// caller stops waiting for it when its own context is done.
+func (c cloudFront) fetchAll() (map[string][]string, error) {
+	ctx := c.fetchContext()
+	results := c.owner().fetches.DoChan("url "+c.url, func() (interface{}, error) {
+		timeout := c.owner().config().fetchTimeout
+		if timeout <= 0 {
+			timeout = sharedFetchTimeout
+		}
+		shared := c
+		var cancel context.CancelFunc
+		shared.ctx, cancel = context.WithTimeout(context.WithoutCancel(ctx), timeout)
+		defer cancel()
+		resp, err := shared.get(c.url)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		data := make(map[string][]string)
+		err = json.NewDecoder(resp.Body).Decode(&data)
+		return data, err
+	})
+	select {
+	case res := <-results:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(map[string][]string), nil
+	case <-ctx.Done():
+		return nil, &FetchError{Provider: c.name, URL: c.url, Err: ctx.Err()}
+	}
+}
+
+func newCloudFront() *cloudFront {
+	return &cloudFront{defaultProvider: defaultProvider{
+		name:      CloudFront,
+		url:       "https://d7uri8nf7uskq.cloudfront.net/tools/list-cloudfront-ips",
+		cache:     newCacheManager(CloudFront),
+		minRanges: 20,
+	}}
+}
+
+// cloudFrontRegional is the regional edge caches' list of the CloudFront
+// endpoint on its own. The cloudfront provider includes it by default, so
+// its addresses can match either provider.
+type cloudFrontRegional struct{ cloudFront }
+
+func (c cloudFrontRegional) FetchIPRanges() ([]string, error) {
+	return c.fetchLists([]string{CloudFrontRegionalEdgeIPList})
+}
+
+func (c cloudFrontRegional) FetchIPRangesWithCache(ctx context.Context) ([]string, error) {
+	return c.fetchWithCache(ctx, c)
+}
+
+func (c cloudFrontRegional) withContext(ctx context.Context) provider {
+	c.ctx = ctx
+	return c
+}
+
+func newCloudFrontRegional() *cloudFrontRegional {
+	return &cloudFrontRegional{cloudFront{defaultProvider: defaultProvider{
+		name:      CloudFrontRegional,
+		url:       "https://d7uri8nf7uskq.cloudfront.net/tools/list-cloudfront-ips",
+		cache:     newCacheManager(CloudFrontRegional),
+		minRanges: 10,
+	}}}
+}
+
+// FetchCloudFrontIPLists fetches the given lists of the CloudFront endpoint
+// with the default client; see Client.FetchCloudFrontIPLists.
+func FetchCloudFrontIPLists(lists ...string) ([]string, error) {
+	return defaultClient.FetchCloudFrontIPLists(lists...)
+}
+
+// FetchCloudFrontIPLists fetches the given lists of the CloudFront endpoint,
+// e.g. only CloudFrontOriginFacingIPList for an origin firewall, whatever
+// WithCloudFrontIPLists selects for the cloudfront provider. The result is
+// not cached, so that the provider's own ranges stay as configured.
+func (cl *Client) FetchCloudFrontIPLists(lists ...string) ([]string, error) {
+	pro, err := cl.GetProvider(CloudFront)
+	if err != nil {
+		return nil, err
+	}
+	p, ok := pro.(interface {
+		fetchLists([]string) ([]string, error)
+	})
+	if !ok {
+		return nil, fmt.Errorf("CDN provider has no CloudFront lists: %s", CloudFront)
+	}
+	return p.fetchLists(lists)
+}
+
+type edgecast struct{ defaultProvider }
+
+func (e edgecast) FetchIPRanges() ([]string, error) {
+	req, err := http.NewRequestWithContext(e.fetchContext(), "GET", e.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	// The API answers in XML unless asked for JSON.
+	req.Header.Set("Accept", "application/json")
+	resp, err := e.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var data struct {
+		SuperBlockIPv4 []string `json:"superBlockIPv4"`
+		SuperBlockIPv6 []string `json:"superBlockIPv6"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+	return e.processLines(append(data.SuperBlockIPv4, data.SuperBlockIPv6...))
+}
+
+func (e edgecast) FetchIPRangesWithCache(ctx context.Context) ([]string, error) {
+	return e.fetchWithCache(ctx, e)
+}
+
+func (e edgecast) withContext(ctx context.Context) provider {
+	e.ctx = ctx
+	return e
+}
+
+func newEdgecast() *edgecast {
+	return &edgecast{defaultProvider: defaultProvider{
+		name:  Edgecast,
+		url:   "https://api.edgecast.com/v2/mcc/customers/superblocks",
+		cache: newCacheManager(Edgecast),
+	}}
+}
+
+type fastly struct{ defaultProvider }
+
+func (f fastly) FetchIPRanges() ([]string, error) {
+	resp, err := f.get(f.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var data struct {
+		Addresses []string `json:"addresses"`
+	}
+	if err = decodeJSON(resp.Body, &data, "addresses"); err != nil {
+		return nil, err
+	}
+	return f.processLines(data.Addresses)
+}
+
+func (f fastly) FetchIPRangesWithCache(ctx context.Context) ([]string, error) {
+	return f.fetchWithCache(ctx, f)
+}
+
+func (f fastly) withContext(ctx context.Context) provider {
+	f.ctx = ctx
+	return f
+}
+
+func newFastly() *fastly {
+	return &fastly{defaultProvider: defaultProvider{
+		name:      Fastly,
+		url:       "https://api.fastly.com/public-ip-list",
+		cache:     newCacheManager(Fastly),
+		minRanges: 10,
+	}}
+}
+
+// Scopes of the google provider, for WithGoogleScope.
+type GoogleScope int
+
+const (
+	// GoogleEdgeOnly covers the ranges Google uses for its own services and
+	// front ends, including Cloud CDN and the load balancers of Google
+	// Cloud, but not the addresses of customer VMs: goog.json minus
+	// cloud.json. It is the default.
+	GoogleEdgeOnly GoogleScope = iota
+	// GoogleAllGCP covers the ranges of Google Cloud customers, cloud.json.
+	// It was the default before GoogleEdgeOnly was introduced.
+	GoogleAllGCP
+	// GoogleAll covers every Google address, goog.json.
+	GoogleAll
+)
+
+type google struct {
+	defaultProvider
+	// cloudURL is the list of Google Cloud customer ranges; url is the list
+	// of all Google ranges.
+	cloudURL string
+}
+
+func (g google) FetchIPRanges() ([]string, error) {
+	switch g.owner().config().googleScope {
+	case GoogleAllGCP:
+		cloud, err := g.fetchPrefixes(g.cloudURL)
+		if err != nil {
+			return nil, err
+		}
+		return g.processLines(cloud)
+	case GoogleAll:
+		all, err := g.fetchPrefixes(g.url)
+		if err != nil {
+			return nil, err
+		}
+		return g.processLines(all)
+	}
+	all, err := g.fetchPrefixes(g.url)
+	if err != nil || len(all) == 0 {
+		return nil, err
+	}
+	cloud, err := g.fetchPrefixes(g.cloudURL)
+	if err != nil {
+		return nil, err
+	}
+	return g.processLines(subtractRanges(all, cloud))
+}
+
+func (g google) FetchIPRangesWithCache(ctx context.Context) ([]string, error) {
+	return g.fetchWithCache(ctx, g)
+}
+
+func (g google) withContext(ctx context.Context) provider {
+	g.ctx = ctx
+	return g
+}
+
+// fetchPrefixes returns the IPv4 prefixes of a Google IP range list.
+func (g google) fetchPrefixes(url string) ([]string, error) {
+	resp, err := g.get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var data struct {
+		Prefixes []struct {
+			IPv4Prefix string `json:"ipv4Prefix"`
+		} `json:"prefixes"`
+	}
+	if err = decodeJSON(resp.Body, &data, "prefixes"); err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, item := range data.Prefixes {
+		if item.IPv4Prefix != "" {
+			result = append(result, item.IPv4Prefix)
+		}
+	}
+	return result, nil
+}
+
+func newGoogle() *google {
+	return &google{
+		defaultProvider: defaultProvider{
+			name:        Google,
+			url:         "https://www.gstatic.com/ipranges/goog.json",
+			cache:       newCacheManager(Google),
+			minRanges:   20,
+			maxBodySize: 64 << 20,
+		},
+		cloudURL: "https://www.gstatic.com/ipranges/cloud.json",
+	}
+}
+
+// Gcore products with their own IP list, for WithGCoreLists.
+const (
+	GCoreStreamingIPList = "streaming"
+)
+
+type gCore struct {
+	defaultProvider
+	// listURLs maps the names of the optional product lists to their URLs.
+	listURLs map[string]string
+}
+
+// gCoreList is the format of Gcore's IP lists.
+type gCoreList struct {
+	Addresses []string `json:"addresses"`
+}
+
+func (g gCore) FetchIPRanges() ([]string, error) {
+	resp, err := g.get(g.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var data gCoreList
+	if err = decodeJSON(resp.Body, &data, "addresses"); err != nil {
+		return nil, err
+	}
+	result := data.Addresses
+	for _, list := range g.owner().config().gCoreLists {
+		addresses, err := g.fetchList(list)
+		if err != nil {
+			logger().Warn("skipping gcore list", "list", list, "error", err)
+			continue
+		}
+		result = append(result, addresses...)
+	}
+	return g.processLines(result)
+}
+
+func (g gCore) FetchIPRangesWithCache(ctx context.Context) ([]string, error) {
+	return g.fetchWithCache(ctx, g)
+}
+
+func (g gCore) withContext(ctx context.Context) provider {
+	g.ctx = ctx
+	return g
+}
+
+func (g gCore) fetchList(list string) ([]string, error) {
+	url, ok := g.listURLs[list]
+	if !ok {
+		return nil, fmt.Errorf("unknown list %q", list)
+	}
+	resp, err := g.get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var data gCoreList
+	err = decodeJSON(resp.Body, &data, "addresses")
+	return data.Addresses, err
+}
+
+func newGCore() *gCore {
+	return &gCore{
+		defaultProvider: defaultProvider{
+			name:      GCore,
+			url:       "https://api.gcore.com/cdn/public-ip-list",
+			cache:     newCacheManager(GCore),
+			minRanges: 20,
+		},
+		listURLs: map[string]string{
+			GCoreStreamingIPList: "https://api.gcore.com/streaming/public-ip-list",
+		},
+	}
+}
+
+type key struct{ defaultProvider }
+
+func (k key) FetchIPRanges() ([]string, error) {
+	resp, err := k.get(k.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var data struct {
+		Prefixes []string `json:"prefixes"`
+	}
+	if err = decodeJSON(resp.Body, &data, "prefixes"); err != nil {
+		return nil, err
+	}
+	return k.processLines(data.Prefixes)
+}
+
+func (k key) FetchIPRangesWithCache(ctx context.Context) ([]string, error) {
+	return k.fetchWithCache(ctx, k)
+}
+
+func (k key) withContext(ctx context.Context) provider {
+	k.ctx = ctx
+	return k
+}
+
+func newKey() *key {
+	return &key{defaultProvider: defaultProvider{
+		name:  Key,
+		url:   "https://www.keycdn.com/shield-prefixes.json",
+		cache: newCacheManager(Key),
+	}}
+}
+
+// mediahub is a CDN aggregator that serves traffic through several
+// underlying CDNs, so its ranges may overlap with theirs and an address can
+// match both mediahub and, say, cloudfront.
+type mediahub struct{ defaultProvider }
+
+// FetchIPRanges reads the list items of Mediahub's IP address page.
+func (m mediahub) FetchIPRanges() ([]string, error) {
+	return m.scrapeRanges(isElement("li"))
+}
+
+func (m mediahub) FetchIPRangesWithCache(ctx context.Context) ([]string, error) {
+	return m.fetchWithCache(ctx, m)
+}
+
+func (m mediahub) withContext(ctx context.Context) provider {
+	m.ctx = ctx
+	return m
+}
+
+func newMediahub() *mediahub {
+	return &mediahub{defaultProvider: defaultProvider{
+		name:  Mediahub,
+		url:   "https://www.mediahub.net/ip-addresses/",
+		cache: newCacheManager(Mediahub),
+	}}
+}
+
+type myra struct{ defaultProvider }
+
+// FetchIPRanges reads the table cells of Myra's IP address page.
+func (m myra) FetchIPRanges() ([]string, error) {
+	return m.scrapeRanges(isElement("td"))
+}
+
+func (m myra) FetchIPRangesWithCache(ctx context.Context) ([]string, error) {
+	return m.fetchWithCache(ctx, m)
+}
+
+func (m myra) withContext(ctx context.Context) provider {
+	m.ctx = ctx
+	return m
+}
+
+func newMyra() *myra {
+	return &myra{defaultProvider: defaultProvider{
+		name:  Myra,
+		url:   "https://www.myrasecurity.com/en/knowledge-hub/ip-addresses/",
+		cache: newCacheManager(Myra),
+	}}
+}
+
+//go:generate sh -c "curl -fsS -H \"Authorization: Bearer $PERIMETERX_TOKEN\" \"$PERIMETERX_IP_LIST_URL\" > data/perimeterx.txt"
+//go:embed data/perimeterx.txt
+var perimeterXRanges string
+
+type perimeterX struct{ defaultProvider }
+
+// configured reports whether there is a list to read: the embedded copy
+// ships without ranges until it is regenerated.
+func (p perimeterX) configured() bool {
+	return p.url != "" || hasValidRange(splitLines(perimeterXRanges))
+}
+
+// FetchIPRanges reads the list, one range per line, from the provider's URL
+// if one is set and otherwise from the copy embedded at build time, since
+// HUMAN publishes it only behind a login.
+func (p perimeterX) FetchIPRanges() ([]string, error) {
+	list := perimeterXRanges
+	if p.url != "" {
+		var err error
+		if list, err = p.getText(p.url); err != nil {
+			return nil, err
+		}
+	}
+	return p.processLines(splitLines(list))
 }
 
-func newGCore() *gCore {
-	return &gCore{defaultProvider: defaultProvider{
-		cache: newCacheManager(GCore),
+func (p perimeterX) FetchIPRangesWithCache(ctx context.Context) ([]string, error) {
+	return p.fetchWithCache(ctx, p)
+}
+
+func (p perimeterX) withContext(ctx context.Context) provider {
+	p.ctx = ctx
+	return p
+}
+
+func newPerimeterX() *perimeterX {
+	return &perimeterX{defaultProvider: defaultProvider{
+		name:  PerimeterX,
+		cache: newCacheManager(PerimeterX),
 	}}
 }
 
-type key struct {
-	defaultProvider
-	Prefixes []string
+type qUic struct{ defaultProvider }
+
+// FetchIPRanges parses the list, addresses separated by line breaks, as
+// HTML so that the exact markup between them doesn't matter. quic.cloud
+// publishes no separate IPv6 list; IPv6 addresses in this one are kept.
+func (q qUic) FetchIPRanges() ([]string, error) {
+	return q.scrapeRanges(isElement("body"))
 }
 
-func (k key) FetchIPRanges() ([]string, error) {
+func (q qUic) FetchIPRangesWithCache(ctx context.Context) ([]string, error) {
+	return q.fetchWithCache(ctx, q)
+}
+
+func (q qUic) withContext(ctx context.Context) provider {
+	q.ctx = ctx
+	return q
+}
+
+func newQUic() *qUic {
+	return &qUic{defaultProvider: defaultProvider{
+		name:  Quic,
+		url:   "https://quic.cloud/ips",
+		cache: newCacheManager(Quic),
+	}}
+}
+
+type reblaze struct{ defaultProvider }
+
+// FetchIPRanges reads the code blocks of Reblaze's documentation of its
+// addresses.
+func (r reblaze) FetchIPRanges() ([]string, error) {
+	return r.scrapeRanges(isElement("code"))
+}
+
+func (r reblaze) FetchIPRangesWithCache(ctx context.Context) ([]string, error) {
+	return r.fetchWithCache(ctx, r)
+}
+
+func (r reblaze) withContext(ctx context.Context) provider {
+	r.ctx = ctx
+	return r
+}
+
+func newReblaze() *reblaze {
+	return &reblaze{defaultProvider: defaultProvider{
+		name:  Reblaze,
+		url:   "https://gb.docs.reblaze.com/reference-information/reblaze-ip-addresses",
+		cache: newCacheManager(Reblaze),
+	}}
+}
+
+// section publishes its ranges either as plain text, one per line, or as
+// JSON: a list of ranges or an object of such lists.
+type section struct{ defaultProvider }
+
+func (s section) FetchIPRanges() ([]string, error) {
 	var result []string
-	resp, err := http.Get("https://www.keycdn.com/shield-prefixes.json")
+	text, err := s.getText(s.url)
 	if err != nil {
 		return result, err
 	}
-	defer resp.Body.Close()
-	err = json.NewDecoder(resp.Body).Decode(&k)
+	bs := []byte(text)
+	switch body := strings.TrimSpace(text); {
+	case strings.HasPrefix(body, "["):
+		err = json.Unmarshal(bs, &result)
+	case strings.HasPrefix(body, "{"):
+		var lists map[string][]string
+		err = json.Unmarshal(bs, &lists)
+		keys := make([]string, 0, len(lists))
+		for key := range lists {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			result = append(result, lists[key]...)
+		}
+	default:
+		result = splitLines(body)
+	}
 	if err != nil {
-		return result, err
+		return nil, err
 	}
-	result = k.processLines(k.Prefixes)
-	return result, nil
+	return s.processLines(result)
 }
 
-func newKey() *key {
-	return &key{defaultProvider: defaultProvider{
-		cache: newCacheManager(Key),
+func (s section) FetchIPRangesWithCache(ctx context.Context) ([]string, error) {
+	return s.fetchWithCache(ctx, s)
+}
+
+func (s section) withContext(ctx context.Context) provider {
+	s.ctx = ctx
+	return s
+}
+
+func newSection() *section {
+	return &section{defaultProvider: defaultProvider{
+		name:  Section,
+		url:   "https://www.section.io/ips.txt",
+		cache: newCacheManager(Section),
 	}}
 }
 
-type qUic struct{ defaultProvider }
+type yandex struct{ defaultProvider }
 
-func (q qUic) FetchIPRanges() ([]string, error) {
-	var result []string
-	resp, err := http.Get("https://quic.cloud/ips")
+func (y yandex) FetchIPRanges() ([]string, error) {
+	var (
+		result []string
+		data   []string
+	)
+	resp, err := y.get(y.url)
 	if err != nil {
 		return result, err
 	}
 	defer resp.Body.Close()
-	bs, err := io.ReadAll(resp.Body)
+	err = json.NewDecoder(resp.Body).Decode(&data)
 	if err != nil {
 		return result, err
 	}
-	result = strings.Split(string(bs), "<br />")
-	result = q.processLines(result)
-	return result, nil
+	return y.processLines(data)
 }
 
-func newQUic() *qUic {
-	return &qUic{defaultProvider: defaultProvider{
-		cache: newCacheManager(Quic),
+func (y yandex) FetchIPRangesWithCache(ctx context.Context) ([]string, error) {
+	return y.fetchWithCache(ctx, y)
+}
+
+func (y yandex) withContext(ctx context.Context) provider {
+	y.ctx = ctx
+	return y
+}
+
+func newYandex() *yandex {
+	return &yandex{defaultProvider: defaultProvider{
+		name:  Yandex,
+		url:   "https://storage.yandexcloud.net/cdn-ip-ranges/ip-ranges.json",
+		cache: newCacheManager(Yandex),
+	}}
+}
+
+//go:embed data/maxcdn-historical.txt
+var maxCDNHistoricalRanges string
+
+type maxCDNHistorical struct{ defaultProvider }
+
+func (m maxCDNHistorical) FetchIPRanges() ([]string, error) {
+	return m.processLines(splitLines(maxCDNHistoricalRanges))
+}
+
+func (m maxCDNHistorical) FetchIPRangesWithCache(ctx context.Context) ([]string, error) {
+	return m.fetchWithCache(ctx, m)
+}
+
+func (m maxCDNHistorical) withContext(ctx context.Context) provider {
+	m.ctx = ctx
+	return m
+}
+
+func newMaxCDNHistorical() *maxCDNHistorical {
+	return &maxCDNHistorical{defaultProvider: defaultProvider{
+		name:  MaxCDNHistorical,
+		cache: &cacheManager{providerName: MaxCDNHistorical, static: true},
 	}}
 }
 
+// GetProvider returns the named provider of the default client.
 func GetProvider(name string) (provider, error) {
-	provider, exists := Providers[name]
+	return defaultClient.GetProvider(name)
+}
+
+// ProviderNames returns the names of the default client's providers; see
+// Client.ProviderNames.
+func ProviderNames() []string {
+	return defaultClient.ProviderNames()
+}
+
+// ProviderNames returns the sorted names of all registered providers,
+// whether in use or not.
+func (cl *Client) ProviderNames() []string {
+	registry := cl.registry()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// GetProvider returns the named provider.
+func (cl *Client) GetProvider(name string) (provider, error) {
+	provider, exists := cl.registry()[name]
 	if !exists {
-		return nil, fmt.Errorf("CDN provider not found: %s", name)
+		return nil, fmt.Errorf("%w: %s", ErrProviderNotFound, name)
 	}
 	return provider, nil
 }
 
+// SetProviderURL changes the source URL of the named provider of the default
+// client.
+func SetProviderURL(name, rawURL string) error {
+	return defaultClient.SetProviderURL(name, rawURL)
+}
+
+// SetProviderURL makes the named provider fetch its ranges from rawURL, e.g.
+// an internal mirror. The URL must use https unless WithAllowInsecureHTTP is
+// set.
+func (cl *Client) SetProviderURL(name, rawURL string) error {
+	pro, err := cl.GetProvider(name)
+	if err != nil {
+		return err
+	}
+	if err = cl.validateSourceURL(rawURL); err != nil {
+		return err
+	}
+	p, ok := pro.(interface{ setURL(string) })
+	if !ok {
+		return fmt.Errorf("CDN provider has no configurable URL: %s", name)
+	}
+	cl.mu.Lock()
+	if cl.explicitURLs == nil {
+		cl.explicitURLs = make(map[string]bool)
+	}
+	cl.explicitURLs[name] = true
+	cl.mu.Unlock()
+	p.setURL(rawURL)
+	return nil
+}
+
+// SetProviderFallbackURL sets the secondary source of the named provider of
+// the default client; see Client.SetProviderFallbackURL.
+func SetProviderFallbackURL(name, rawURL string) error {
+	return defaultClient.SetProviderFallbackURL(name, rawURL)
+}
+
+// SetProviderFallbackURL makes the named provider fetch its ranges from
+// rawURL, e.g. a mirror, whenever its primary source fails to respond or
+// responds with an error status. The URL must use https unless
+// WithAllowInsecureHTTP is set. An empty rawURL removes the fallback.
+func (cl *Client) SetProviderFallbackURL(name, rawURL string) error {
+	pro, err := cl.GetProvider(name)
+	if err != nil {
+		return err
+	}
+	if rawURL != "" {
+		if err = cl.validateSourceURL(rawURL); err != nil {
+			return err
+		}
+	}
+	p, ok := pro.(interface{ setFallbackURL(string) })
+	if !ok {
+		return fmt.Errorf("CDN provider has no configurable URL: %s", name)
+	}
+	p.setFallbackURL(rawURL)
+	return nil
+}
+
+// activeProviders returns the registered providers, restricted to the
+// configured subset and without disabled ones. Unless a subset is
+// configured, providers that have nothing to fetch yet are left out too.
+func (cl *Client) activeProviders() map[string]provider {
+	c := cl.config()
+	registry := cl.registry()
+	active := make(map[string]provider, len(registry))
+	for name, pro := range registry {
+		if len(c.providers) > 0 && !slices.Contains(c.providers, name) {
+			continue
+		}
+		if cf, ok := pro.(configurer); ok && len(c.providers) == 0 && !cf.configured() {
+			continue
+		}
+		if slices.Contains(c.disabledProviders, name) {
+			continue
+		}
+		active[name] = pro
+	}
+	return active
+}
+
+// activeProviderNames returns the names of activeProviders, sorted.
+func (cl *Client) activeProviderNames() []string {
+	providers := cl.activeProviders()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetEnabledProviders restricts the default client to the named providers;
+// see Client.SetEnabledProviders.
+func SetEnabledProviders(names ...string) error {
+	return defaultClient.SetEnabledProviders(names...)
+}
+
+// SetEnabledProviders restricts lookups, PreCache and ExportCache to the
+// named providers. Calling it without names enables all registered
+// providers again, which is the default, except those that have no ranges
+// until they are configured, such as CloudFlareAccess without a URL. Nothing is
+// changed if a name is unknown.
+func (cl *Client) SetEnabledProviders(names ...string) error {
+	for _, name := range names {
+		if _, err := cl.GetProvider(name); err != nil {
+			return err
+		}
+	}
+	cl.SetOptions(func(c *config) {
+		c.providers = slices.Clone(names)
+	})
+	return nil
+}
+
+// SetStaleWhileRevalidate sets whether the default client serves expired
+// ranges; see Client.SetStaleWhileRevalidate.
+func SetStaleWhileRevalidate(enabled bool) {
+	defaultClient.SetStaleWhileRevalidate(enabled)
+}
+
+// SetStaleWhileRevalidate makes FetchIPRangesWithCache, and so QueryName,
+// return expired cached ranges at once instead of waiting for a refetch,
+// which then happens in the background. Until it succeeds, the expired
+// ranges keep being served. A provider without cached ranges is still
+// fetched synchronously. It is off by default.
+func (cl *Client) SetStaleWhileRevalidate(enabled bool) {
+	cl.SetOptions(func(c *config) {
+		c.staleWhileRevalidate = enabled
+	})
+}
+
+// FetchIPRangesStaleWhileRevalidate returns the named provider's ranges
+// from the default client's cache; see
+// Client.FetchIPRangesStaleWhileRevalidate.
+func FetchIPRangesStaleWhileRevalidate(ctx context.Context, providerName string) ([]string, bool, error) {
+	return defaultClient.FetchIPRangesStaleWhileRevalidate(ctx, providerName)
+}
+
+// FetchIPRangesStaleWhileRevalidate returns the named provider's cached
+// ranges at once, whatever SetStaleWhileRevalidate is set to, and reports
+// whether they have expired. Expired ranges are refreshed in the
+// background, by one refresh per provider at a time. Only a provider
+// without cached ranges is fetched before returning, which ctx can cut
+// short; the fetch is then cancelled unless another caller waits for it.
+func (cl *Client) FetchIPRangesStaleWhileRevalidate(ctx context.Context, providerName string) ([]string, bool, error) {
+	pro, err := cl.GetProvider(providerName)
+	if err != nil {
+		return nil, false, err
+	}
+	if cm := cacheOf(pro); cm != nil {
+		cache, err := cm.current()
+		if err == nil && len(cache.IPRanges) > 0 {
+			observeCache(providerName, true)
+			if !cm.expired(cache) {
+				return cache.IPRanges, false, nil
+			}
+			if r, ok := pro.(interface{ revalidate(provider) }); ok {
+				r.revalidate(pro)
+			}
+			return cache.IPRanges, true, nil
+		}
+	}
+	ipRanges, err := pro.FetchIPRangesWithCache(ctx)
+	return ipRanges, false, err
+}
+
+// SetMaxConcurrency limits the fan-out of the default client; see
+// Client.SetMaxConcurrency.
+func SetMaxConcurrency(n int) {
+	defaultClient.SetMaxConcurrency(n)
+}
+
+// SetMaxConcurrency limits how many providers PreCache, QueryName and
+// CheckAll fetch at the same time. Zero, the default, means no limit.
+func (cl *Client) SetMaxConcurrency(n int) {
+	cl.SetOptions(func(c *config) {
+		c.maxConcurrency = max(n, 0)
+	})
+}
+
+type semaphore chan struct{}
+
+func newSemaphore(n int) semaphore {
+	if n > 0 {
+		return make(semaphore, n)
+	}
+	return nil
+}
+
+func (s semaphore) acquire() {
+	if s != nil {
+		s <- struct{}{}
+	}
+}
+
+func (s semaphore) release() {
+	if s != nil {
+		<-s
+	}
+}
+
+// PreCache fetches the ranges of the default client's providers into the
+// cache.
 func PreCache() {
-	for _, pro := range Providers {
-		_, _ = pro.FetchIPRangesWithCache(pro)
+	defaultClient.PreCache()
+}
+
+// PreCache fetches the ranges of every provider in use into the cache, so
+// that later lookups don't wait for the network.
+func (cl *Client) PreCache() {
+	providers := cl.activeProviders()
+	sem := newSemaphore(cl.config().maxConcurrency)
+	var wg sync.WaitGroup
+	for name, pro := range providers {
+		wg.Add(1)
+		go func(name string, pro provider) {
+			defer wg.Done()
+			sem.acquire()
+			defer sem.release()
+			_, err := pro.FetchIPRangesWithCache(context.Background())
+			if err != nil {
+				logger().Warn("precache failed", "provider", name, "error", err)
+			}
+		}(name, pro)
+	}
+	wg.Wait()
+}
+
+// PreCacheStale refreshes the default client's expired or missing caches;
+// see Client.PreCacheStale.
+func PreCacheStale() map[string]error {
+	return defaultClient.PreCacheStale()
+}
+
+// PreCacheStale is like PreCache but leaves providers whose cache is fresh
+// alone, without reading their cache files a second time. It returns the
+// outcome of each refresh, nil on success, keyed by provider; fresh
+// providers are not included.
+func (cl *Client) PreCacheStale() map[string]error {
+	result := make(map[string]error)
+	var mu sync.Mutex
+	sem := newSemaphore(cl.config().maxConcurrency)
+	var wg sync.WaitGroup
+	for name, pro := range cl.activeProviders() {
+		if cm := cacheOf(pro); cm != nil {
+			cache, err := cm.current()
+			if err == nil && len(cache.IPRanges) > 0 && !cm.expired(cache) {
+				continue
+			}
+		}
+		wg.Add(1)
+		go func(name string, pro provider) {
+			defer wg.Done()
+			sem.acquire()
+			defer sem.release()
+			var err error
+			if r, ok := pro.(interface {
+				refresh(context.Context, provider) ([]string, error)
+			}); ok {
+				_, err = r.refresh(context.Background(), pro)
+			} else {
+				_, err = pro.FetchIPRangesWithCache(context.Background())
+			}
+			if err != nil {
+				logger().Warn("precache failed", "provider", name, "error", err)
+			}
+			mu.Lock()
+			result[name] = err
+			mu.Unlock()
+		}(name, pro)
 	}
+	wg.Wait()
+	return result
+}
+
+// WarmStart returns the default client's cached ranges and refreshes stale
+// ones in the background; see Client.WarmStart.
+func WarmStart(ctx context.Context) map[string][]string {
+	return defaultClient.WarmStart(ctx)
+}
+
+// WarmStart returns the cached ranges of every provider in use, expired or
+// not, without waiting for the network. Providers whose cache is expired or
+// missing are refreshed in the background; refreshes that have not started
+// when ctx is done are skipped.
+func (cl *Client) WarmStart(ctx context.Context) map[string][]string {
+	result := make(map[string][]string)
+	sem := newSemaphore(cl.config().maxConcurrency)
+	for name, pro := range cl.activeProviders() {
+		cm := cacheOf(pro)
+		if cm == nil {
+			continue
+		}
+		cache, err := cm.current()
+		if err == nil && len(cache.IPRanges) > 0 {
+			result[name] = cache.IPRanges
+			if !cm.expired(cache) {
+				continue
+			}
+		}
+		go func(name string, pro provider) {
+			sem.acquire()
+			defer sem.release()
+			if ctx.Err() != nil {
+				return
+			}
+			if _, err := pro.FetchIPRangesWithCache(context.Background()); err != nil {
+				logger().Warn("warm start refresh failed", "provider", name, "error", err)
+			}
+		}(name, pro)
+	}
+	return result
 }
 
+// QueryName returns the name of the default client's provider whose ranges
+// contain ip, or "" if there is none.
 func QueryName(ip net.IP) string {
+	return defaultClient.QueryName(ip)
+}
+
+// QueryName returns the name of a provider whose ranges contain ip, or "" if
+// there is none or ip is not a valid address, e.g. nil. IPv4-mapped IPv6
+// addresses such as ::ffff:192.0.2.1 match IPv4 ranges. Private and other
+// unroutable addresses, see IsPrivateOrBogon, get "" without a lookup
+// unless WithBogonFilter turns that off.
+func (cl *Client) QueryName(ip net.IP) string {
+	name, _ := cl.QueryNameWithNetwork(ip)
+	return name
+}
+
+// QueryNameWithNetwork is like QueryName for the default client but also
+// returns the matching range.
+func QueryNameWithNetwork(ip net.IP) (string, *net.IPNet) {
+	return defaultClient.QueryNameWithNetwork(ip)
+}
+
+// QueryNameWithNetwork is like QueryName but also returns the range that
+// contains ip. On no match or an invalid ip it returns "" and nil.
+func (cl *Client) QueryNameWithNetwork(ip net.IP) (string, *net.IPNet) {
+	type match struct {
+		name    string
+		network *net.IPNet
+	}
+	if ip = normalizeIP(ip); ip == nil {
+		return "", nil
+	}
+	c := cl.config()
+	if !c.noBogonFilter && IsPrivateOrBogon(ip) {
+		return "", nil
+	}
+	key := lookupKey(ip)
+	cached, gen := cl.lookups.get(key, c.cacheTTL)
+	if cached != nil {
+		metrics().ObserveLookup(cached.name)
+		return cached.name, cached.network
+	}
+	providers := cl.activeProviders()
+	sem := newSemaphore(c.maxConcurrency)
 	var wg sync.WaitGroup
-	resultChan := make(chan string, len(Providers))
+	resultChan := make(chan match, len(providers))
 	done := make(chan struct{})
-	go func() {
-		wg.Wait()
-		close(done)
-	}()
-	for name, pro := range Providers {
+	// failed is set when a provider has no ranges, so that a result that
+	// might have been different with them isn't cached for cacheTTL.
+	var failed atomic.Bool
+	for name, pro := range providers {
 		wg.Add(1)
 		go func(name string, pro provider) {
 			defer wg.Done()
-			ipRanges, err := pro.FetchIPRangesWithCache(pro)
+			sem.acquire()
+			defer sem.release()
+			ipRanges, err := pro.FetchIPRangesWithCache(context.Background())
 			if err != nil {
+				failed.Store(true)
 				return
 			}
-			for _, rangeOrIP := range ipRanges {
-				_, cidr, err := net.ParseCIDR(rangeOrIP)
-				if err != nil {
-					if rangeOrIP == ip.String() {
-						resultChan <- name
-						return
-					}
-				} else {
-					if cidr.Contains(ip) {
-						resultChan <- name
-						return
-					}
-				}
+			if network := cl.lookupRanges(name, pro, ipRanges, ip); network != nil {
+				resultChan <- match{name, network}
 			}
 		}(name, pro)
 	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	var result match
 	select {
-	case result := <-resultChan:
-		return result
+	case result = <-resultChan:
 	case <-done:
-		return ""
+		// A match sent just before done was closed is still buffered.
+		select {
+		case result = <-resultChan:
+		default:
+		}
+	}
+	if !failed.Load() {
+		cl.lookups.put(gen, key, result.name, result.network)
+	}
+	metrics().ObserveLookup(result.name)
+	return result.name, result.network
+}
+
+// validIP reports whether ip has the length of an IPv4 or IPv6 address.
+func validIP(ip net.IP) bool {
+	return len(ip) == net.IPv4len || len(ip) == net.IPv6len
+}
+
+// normalizeIP returns ip in the form lookups expect: IPv4 addresses,
+// including IPv4-mapped IPv6 ones such as ::ffff:192.0.2.1, in their 4-byte
+// form, so that they match IPv4 ranges whatever their origin. It returns
+// nil for an invalid ip.
+func normalizeIP(ip net.IP) net.IP {
+	if !validIP(ip) {
+		return nil
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+// ParseIP parses an address as found in logs and headers for QueryName and
+// CheckAll. Unlike net.ParseIP it accepts an IPv6 address in brackets or
+// with a zone, such as fe80::1%eth0, which is dropped since ranges don't
+// have one, and it returns IPv4-mapped IPv6 addresses in their 4-byte form.
+// It returns nil if s is not an address.
+func ParseIP(s string) net.IP {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		s = s[1 : len(s)-1]
+	}
+	if i := strings.IndexByte(s, '%'); i >= 0 && strings.Contains(s[:i], ":") {
+		s = s[:i]
+	}
+	return normalizeIP(net.ParseIP(s))
+}
+
+// CheckAll checks ip against every provider of the default client; see
+// Client.CheckAll.
+func CheckAll(ctx context.Context, ip net.IP) (map[string]bool, error) {
+	return defaultClient.CheckAll(ctx, ip)
+}
+
+// CheckAll reports, for every provider in use, whether ip is in its
+// ranges. Providers are checked in parallel; a provider that fails is
+// reported as false and its error is included in the returned error, which
+// joins all failures. An invalid ip fails with ErrInvalidIP.
+func (cl *Client) CheckAll(ctx context.Context, ip net.IP) (map[string]bool, error) {
+	type check struct {
+		name    string
+		matched bool
+		err     error
+	}
+	if ip = normalizeIP(ip); ip == nil {
+		return nil, ErrInvalidIP
+	}
+	providers := cl.activeProviders()
+	checks := make(chan check, len(providers))
+	result := make(map[string]bool, len(providers))
+	pending := make(map[string]bool, len(providers))
+	sem := newSemaphore(cl.config().maxConcurrency)
+	for name, pro := range providers {
+		result[name] = false
+		pending[name] = true
+		go func(name string, pro provider) {
+			sem.acquire()
+			defer sem.release()
+			ipRanges, err := pro.FetchIPRangesWithCache(context.Background())
+			checks <- check{name: name, matched: err == nil && cl.matchRanges(name, pro, ipRanges, ip), err: err}
+		}(name, pro)
+	}
+	var errs []error
+	for len(pending) > 0 {
+		select {
+		case c := <-checks:
+			delete(pending, c.name)
+			result[c.name] = c.matched
+			if c.err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", c.name, c.err))
+			}
+		case <-ctx.Done():
+			for name := range pending {
+				errs = append(errs, fmt.Errorf("%s: %w", name, ctx.Err()))
+			}
+			return result, errors.Join(errs...)
+		}
+	}
+	return result, errors.Join(errs...)
+}
+
+// builtinFactories registers the built-in providers; they are constructed
+// by loadBuiltins and NewClient. The constructors must not touch the
+// filesystem, the environment or the network: cache files and settings are
+// only read once a provider is used.
+var builtinFactories = map[string]func() provider{
+	Akamai:             func() provider { return newAkamai() },
+	Bunny:              func() provider { return newBunny() },
+	CacheFly:           func() provider { return newCacheFly() },
+	CloudFlare:         func() provider { return newCloudFlare() },
+	CloudFlareAccess:   func() provider { return newCloudFlareAccess() },
+	CloudFlareWarp:     func() provider { return newCloudFlareWarp() },
+	CloudFront:         func() provider { return newCloudFront() },
+	CloudFrontRegional: func() provider { return newCloudFrontRegional() },
+	Edgecast:           func() provider { return newEdgecast() },
+	Fastly:             func() provider { return newFastly() },
+	GCore:              func() provider { return newGCore() },
+	Google:             func() provider { return newGoogle() },
+	Key:                func() provider { return newKey() },
+	Mediahub:           func() provider { return newMediahub() },
+	Myra:               func() provider { return newMyra() },
+	PerimeterX:         func() provider { return newPerimeterX() },
+	Quic:               func() provider { return newQUic() },
+	Reblaze:            func() provider { return newReblaze() },
+	Section:            func() provider { return newSection() },
+	Yandex:             func() provider { return newYandex() },
+	MaxCDNHistorical:   func() provider { return newMaxCDNHistorical() },
+}
+
+// builtinProviders returns new instances of all built-in providers.
+func builtinProviders() map[string]provider {
+	providers := make(map[string]provider, len(builtinFactories))
+	for name, factory := range builtinFactories {
+		providers[name] = factory()
 	}
+	return providers
 }
 
-func init() {
-	Providers[Akamai] = newAkamai()
-	Providers[Bunny] = newBunny()
-	Providers[CacheFly] = newCacheFly()
-	Providers[CloudFlare] = newCloudFlare()
-	Providers[CloudFront] = newCloudFront()
-	Providers[Fastly] = newFastly()
-	Providers[GCore] = newGCore()
-	Providers[Google] = newGoogle()
-	Providers[Key] = newKey()
-	Providers[Quic] = newQUic()
+// loadBuiltins adds the built-in providers to Providers, except where a
+// provider of the same name was added before.
+func loadBuiltins() {
+	defaultClient.regMu.Lock()
+	defer defaultClient.regMu.Unlock()
+	registry := builtinProviders()
+	maps.Copy(registry, Providers)
+	Providers = registry
 }
@@ -1,9 +1,26 @@
 package cdn
 
 import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestCDN(t *testing.T) {
@@ -23,3 +40,1320 @@ func TestCDN(t *testing.T) {
 		fmt.Printf("%s IP ranges: %v\n", name, ipRanges)
 	}
 }
+
+type staticProvider struct {
+	defaultProvider
+	ranges []string
+	err    error
+	delay  time.Duration
+	calls  *atomic.Int32
+	gauge  *inFlightGauge
+}
+
+// inFlightGauge records the peak number of concurrent fetches.
+type inFlightGauge struct {
+	mu        sync.Mutex
+	cur, peak int
+}
+
+func (g *inFlightGauge) enter() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.cur++
+	g.peak = max(g.peak, g.cur)
+}
+
+func (g *inFlightGauge) leave() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.cur--
+}
+
+// reset returns the peak so far and starts a new measurement.
+func (g *inFlightGauge) reset() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	peak := g.peak
+	g.peak = g.cur
+	return peak
+}
+
+func (s staticProvider) FetchIPRanges() ([]string, error) {
+	s.calls.Add(1)
+	if s.gauge != nil {
+		s.gauge.enter()
+		defer s.gauge.leave()
+	}
+	time.Sleep(s.delay)
+	return s.ranges, s.err
+}
+
+func (s staticProvider) FetchIPRangesWithCache(ctx context.Context) ([]string, error) {
+	return s.fetchWithCache(ctx, s)
+}
+
+func newStaticProvider(name string, ranges ...string) *staticProvider {
+	return &staticProvider{
+		defaultProvider: defaultProvider{
+			name:  name,
+			url:   "https://example.com/" + name,
+			cache: newCacheManager(name),
+		},
+		ranges: ranges,
+		calls:  new(atomic.Int32),
+	}
+}
+
+func TestLogger(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	var buf bytes.Buffer
+	SetLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer SetLogger(nil)
+
+	p := newStaticProvider("test", "192.0.2.0/24")
+	for i := 0; i < 2; i++ {
+		if _, err := p.FetchIPRangesWithCache(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, msg := range []string{"cache miss", "fetch start", "fetch finish", "cache hit"} {
+		if !strings.Contains(buf.String(), "msg=\""+msg+"\"") {
+			t.Errorf("missing %q event in:\n%s", msg, buf.String())
+		}
+	}
+}
+
+func TestSetLoggerDuringFetches(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	defer SetLogger(nil)
+	p := newStaticProvider("test", "192.0.2.0/24")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			p.fetchAndCache(p)
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	}
+	<-done
+}
+
+func serveFile(t *testing.T, path string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, path)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCloudFrontRegionalEdge(t *testing.T) {
+	p := newCloudFront()
+	p.url = serveFile(t, "testdata/cloudfront.json").URL
+	ipRanges, err := p.FetchIPRanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"120.52.22.96/27", "13.113.196.64/26", "2600:9000::/28", "2600:9000:1000::/36"} {
+		if !slices.Contains(ipRanges, want) {
+			t.Errorf("%s missing from %v", want, ipRanges)
+		}
+	}
+}
+
+func TestCloudFrontRegional(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		time.Sleep(100 * time.Millisecond)
+		http.ServeFile(w, r, "testdata/cloudfront.json")
+	}))
+	defer srv.Close()
+	all := newCloudFront()
+	all.url = srv.URL
+	regional := newCloudFrontRegional()
+	regional.url = srv.URL
+
+	var wg sync.WaitGroup
+	results := make([][]string, 2)
+	for i, p := range []provider{all, regional} {
+		wg.Add(1)
+		go func(i int, p provider) {
+			defer wg.Done()
+			ipRanges, err := p.FetchIPRanges()
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = ipRanges
+		}(i, p)
+	}
+	wg.Wait()
+	if want := []string{"13.113.196.64/26", "13.113.203.0/24", "13.124.199.0/24", "52.199.127.192/26", "2600:9000:1000::/36"}; !slices.Equal(results[1], want) {
+		t.Errorf("regional FetchIPRanges = %v; want %v", results[1], want)
+	}
+	if !slices.Contains(results[0], "120.52.22.96/27") || !slices.Contains(results[0], "13.113.196.64/26") {
+		t.Errorf("cloudfront FetchIPRanges = %v", results[0])
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("endpoint requested %d times; want the fetch shared", n)
+	}
+}
+
+func TestProcessLines(t *testing.T) {
+	dp := defaultProvider{name: "test"}
+	got, err := dp.processLines([]string{"# ranges", "cidr,region", "192.0.2.0/24\t", " 2001:db8::/32 ", "", "<br>", "198.51.100.7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"192.0.2.0/24", "198.51.100.7", "2001:db8::/32"}; !slices.Equal(got, want) {
+		t.Errorf("processLines = %v; want %v", got, want)
+	}
+	if _, err = dp.processLines([]string{"<html>", "Service Unavailable", "</html>"}); !errors.Is(err, ErrNoValidRanges) {
+		t.Errorf("processLines without valid entries: err = %v; want ErrNoValidRanges", err)
+	}
+}
+
+func TestCRLFLineEndings(t *testing.T) {
+	p := newCloudFlare()
+	p.url = serveText(t, "# ranges\r\n192.0.2.0/24\r\n\r\n2001:db8::/32\r\n198.51.100.7\r\n")
+	ipRanges, err := p.FetchIPRanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"192.0.2.0/24", "198.51.100.7", "2001:db8::/32"}; !slices.Equal(ipRanges, want) {
+		t.Errorf("FetchIPRanges = %q; want %q", ipRanges, want)
+	}
+	if got := splitLines("a\r\nb\nc"); !slices.Equal(got, []string{"a", "b", "c"}) {
+		t.Errorf("splitLines = %q", got)
+	}
+}
+
+func TestProcessLinesCanonicalForm(t *testing.T) {
+	dp := defaultProvider{name: "test"}
+	got, err := dp.processLines([]string{
+		"2001:0DB8:0000::/32", "2001:db8::/32", "2001:db8:0:0:0:0:0:1", "2001:DB8::1",
+		"2001:db8:1::ff/48", "::ffff:192.0.2.0/120", "192.0.2.0/24", "::ffff:198.51.100.7",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"192.0.2.0/24", "198.51.100.7", "2001:db8::/32", "2001:db8::1", "2001:db8:1::/48"}
+	if !slices.Equal(got, want) {
+		t.Errorf("processLines = %v; want %v", got, want)
+	}
+}
+
+func TestTextSourceQuirks(t *testing.T) {
+	var buf bytes.Buffer
+	SetLogger(slog.New(slog.NewTextHandler(&buf, nil)))
+	defer SetLogger(nil)
+	p := newCacheFly()
+	p.url = serveFile(t, "testdata/cachefly.txt").URL
+	ipRanges, err := p.FetchIPRanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"192.0.2.0/24", "198.51.100.7"}; !slices.Equal(ipRanges, want) {
+		t.Errorf("FetchIPRanges = %q; want %q", ipRanges, want)
+	}
+	if strings.Contains(buf.String(), "dropped invalid entries") {
+		t.Errorf("comments or BOM counted as invalid entries:\n%s", buf.String())
+	}
+}
+
+func TestProcessLinesCanonicalOrder(t *testing.T) {
+	dp := defaultProvider{name: "test"}
+	got, err := dp.processLines([]string{
+		"2001:db8::/32", "198.51.100.0/24", "192.0.2.0/24", "10.0.0.0/8", "192.0.2.0/25",
+		"198.51.100.0/24", "2001:db8::/32", "192.0.2.7", "192.0.2.7/32", "10.0.0.0/16", "2001:db8::/48",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"10.0.0.0/8", "10.0.0.0/16", "192.0.2.0/24", "192.0.2.0/25", "192.0.2.7", "198.51.100.0/24", "2001:db8::/32", "2001:db8::/48"}
+	if !slices.Equal(got, want) {
+		t.Errorf("processLines = %v; want %v", got, want)
+	}
+}
+
+func TestEdgecast(t *testing.T) {
+	var accept string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept = r.Header.Get("Accept")
+		http.ServeFile(w, r, "testdata/edgecast.json")
+	}))
+	defer srv.Close()
+	p := newEdgecast()
+	p.url = srv.URL
+	ipRanges, err := p.FetchIPRanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"5.104.64.0/21", "46.22.64.0/20", "72.21.80.0/20", "93.184.208.0/20", "2606:2800::/32", "2a02:16a8::/32"}
+	if !slices.Equal(ipRanges, want) {
+		t.Errorf("FetchIPRanges = %v; want %v", ipRanges, want)
+	}
+	if accept != "application/json" {
+		t.Errorf("Accept = %q; want application/json", accept)
+	}
+}
+
+func TestCloudFlareWarp(t *testing.T) {
+	p := newCloudFlareWarp()
+	p.url = serveFile(t, "testdata/cloudflare-warp.html").URL
+	ipRanges, err := p.FetchIPRanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"104.28.0.0/16", "2a09:bac0::/29"}; !slices.Equal(ipRanges, want) {
+		t.Errorf("FetchIPRanges = %v; want %v", ipRanges, want)
+	}
+}
+
+func TestMediahub(t *testing.T) {
+	p := newMediahub()
+	p.url = serveFile(t, "testdata/mediahub.html").URL
+	ipRanges, err := p.FetchIPRanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"198.51.100.64/26", "203.0.113.0/25", "2001:db8:4d::/48"}
+	if !slices.Equal(ipRanges, want) {
+		t.Errorf("FetchIPRanges = %v; want %v", ipRanges, want)
+	}
+}
+
+func TestMyra(t *testing.T) {
+	p := newMyra()
+	p.url = serveFile(t, "testdata/myra.html").URL
+	ipRanges, err := p.FetchIPRanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"198.51.100.0/24", "203.0.113.128/25", "2001:db8:a::/48"}
+	if !slices.Equal(ipRanges, want) {
+		t.Errorf("FetchIPRanges = %v; want %v", ipRanges, want)
+	}
+}
+
+func TestReblaze(t *testing.T) {
+	p := newReblaze()
+	p.url = serveFile(t, "testdata/reblaze.html").URL
+	ipRanges, err := p.FetchIPRanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"198.51.100.32/27", "203.0.113.0/26", "203.0.113.64/26"}
+	if !slices.Equal(ipRanges, want) {
+		t.Errorf("FetchIPRanges = %v; want %v", ipRanges, want)
+	}
+
+	// A page without the list yields nothing rather than its other addresses.
+	p.url = serveFile(t, "testdata/mediahub.html").URL
+	if ipRanges, err := p.FetchIPRanges(); !errors.Is(err, ErrNoValidRanges) {
+		t.Errorf("other page: FetchIPRanges = %v, %v; want ErrNoValidRanges", ipRanges, err)
+	}
+}
+
+func TestAkamai(t *testing.T) {
+	want := []string{"2.16.0.0/13", "23.32.0.0/11", "23.192.0.0/11", "104.64.0.0/10", "2600:1400::/24"}
+	for _, fixture := range []string{"testdata/akamai.html", "testdata/akamai-mangled.html"} {
+		p := newAkamai()
+		p.url = serveFile(t, fixture).URL
+		ipRanges, err := p.FetchIPRanges()
+		if err != nil {
+			t.Errorf("%s: %v", fixture, err)
+			continue
+		}
+		if !slices.Equal(ipRanges, want) {
+			t.Errorf("%s: FetchIPRanges = %v; want %v", fixture, ipRanges, want)
+		}
+	}
+
+	p := newAkamai()
+	p.url = serveText(t, "<html><body><p>Moved to 192.0.2.1</p><pre><code>23.32.0.0/11\n23.32.0.0/11</code></pre></body></html>")
+	if ipRanges, err := p.FetchIPRanges(); err != nil || !slices.Equal(ipRanges, []string{"23.32.0.0/11"}) {
+		t.Errorf("plain code block: %v, %v", ipRanges, err)
+	}
+	p.url = serveText(t, "<html><body><p>This page has moved.</p></body></html>")
+	if _, err := p.FetchIPRanges(); !errors.Is(err, ErrNoValidRanges) {
+		t.Errorf("page without ranges: err = %v; want ErrNoValidRanges", err)
+	}
+}
+
+func TestAkamaiAPI(t *testing.T) {
+	restoreConfig(t)
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		http.ServeFile(w, r, "testdata/akamai-cidr-blocks.json")
+	}))
+	defer srv.Close()
+	SetOptions(WithAllowInsecureHTTP(true))
+	if err := SetAkamaiAPIToken(srv.URL+"/firewall-rules-manager/v1/cidr-blocks", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	p := newAkamai()
+	p.url = serveText(t, "<html><body><pre>192.0.2.0/24</pre></body></html>")
+	ipRanges, err := p.FetchIPRanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"2.16.0.0/13", "23.32.0.0/11", "2600:1400::/24"}; !slices.Equal(ipRanges, want) {
+		t.Errorf("FetchIPRanges = %v; want %v", ipRanges, want)
+	}
+	if auth != "Bearer secret" {
+		t.Errorf("Authorization = %q", auth)
+	}
+
+	if err := SetAkamaiAPIToken("", ""); err != nil {
+		t.Fatal(err)
+	}
+	if ipRanges, err = p.FetchIPRanges(); err != nil || !slices.Equal(ipRanges, []string{"192.0.2.0/24"}) {
+		t.Errorf("without a token: %v, %v", ipRanges, err)
+	}
+}
+
+func TestWithGoogleScope(t *testing.T) {
+	restoreConfig(t)
+	p := newGoogle()
+	p.url = serveFile(t, "testdata/goog.json").URL
+	p.cloudURL = serveFile(t, "testdata/cloud.json").URL
+	for scope, want := range map[GoogleScope][]string{
+		GoogleEdgeOnly: {"8.8.4.0/24", "34.112.0.0/12", "35.190.64.0/18"},
+		GoogleAllGCP:   {"34.64.0.0/11", "34.96.0.0/12", "35.190.0.0/18"},
+		GoogleAll:      {"8.8.4.0/24", "34.64.0.0/10", "35.190.0.0/17"},
+	} {
+		SetOptions(WithGoogleScope(scope))
+		ipRanges, err := p.FetchIPRanges()
+		if err != nil {
+			t.Errorf("scope %d: %v", scope, err)
+			continue
+		}
+		if !slices.Equal(ipRanges, want) {
+			t.Errorf("scope %d: FetchIPRanges = %v; want %v", scope, ipRanges, want)
+		}
+	}
+}
+
+func TestPerimeterX(t *testing.T) {
+	saved := perimeterXRanges
+	defer func() { perimeterXRanges = saved }()
+	perimeterXRanges = "# exported from the portal\n192.0.2.0/24\n198.51.100.0/25\n"
+
+	p := newPerimeterX()
+	if ipRanges, err := p.FetchIPRanges(); err != nil || !slices.Equal(ipRanges, []string{"192.0.2.0/24", "198.51.100.0/25"}) {
+		t.Errorf("embedded list: %v, %v", ipRanges, err)
+	}
+	p.url = serveText(t, "# mirror\n203.0.113.0/24\n")
+	if ipRanges, err := p.FetchIPRanges(); err != nil || !slices.Equal(ipRanges, []string{"203.0.113.0/24"}) {
+		t.Errorf("mirror: %v, %v", ipRanges, err)
+	}
+}
+
+func TestPerimeterXOptIn(t *testing.T) {
+	saved := perimeterXRanges
+	defer func() { perimeterXRanges = saved }()
+	perimeterXRanges = "# not exported yet\n"
+
+	cl := NewClient()
+	if _, ok := cl.activeProviders()[PerimeterX]; ok {
+		t.Error("perimeterx in use without a list")
+	}
+	if err := cl.SetEnabledProviders(PerimeterX); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cl.activeProviders()[PerimeterX]; !ok {
+		t.Error("perimeterx not in use when enabled by name")
+	}
+	if err := cl.SetEnabledProviders(); err != nil {
+		t.Fatal(err)
+	}
+	perimeterXRanges = "192.0.2.0/24\n"
+	if _, ok := cl.activeProviders()[PerimeterX]; !ok {
+		t.Error("perimeterx not in use with an embedded list")
+	}
+}
+
+func TestCloudFlareAccess(t *testing.T) {
+	p := newCloudFlareAccess()
+	if _, err := p.FetchIPRanges(); !errors.Is(err, ErrNoValidRanges) {
+		t.Errorf("without a list: err = %v; want ErrNoValidRanges", err)
+	}
+	p.url = serveText(t, "192.0.2.0/24\n2001:db8::/32\n")
+	if ipRanges, err := p.FetchIPRanges(); err != nil || !slices.Equal(ipRanges, []string{"192.0.2.0/24", "2001:db8::/32"}) {
+		t.Errorf("plain list: %v, %v", ipRanges, err)
+	}
+	p.url = serveText(t, `{"result": {"ipv4_cidrs": ["198.51.100.0/24"], "ipv6_cidrs": ["2001:db8:1::/48"]}, "success": true}`)
+	if ipRanges, err := p.FetchIPRanges(); err != nil || !slices.Equal(ipRanges, []string{"198.51.100.0/24", "2001:db8:1::/48"}) {
+		t.Errorf("API response: %v, %v", ipRanges, err)
+	}
+
+	cl := NewClient()
+	if _, ok := cl.activeProviders()[CloudFlareAccess]; ok {
+		t.Error("cloudflare-access in use without a list")
+	}
+	if err := cl.SetProviderURL(CloudFlareAccess, "https://example.com/access.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cl.activeProviders()[CloudFlareAccess]; !ok {
+		t.Error("cloudflare-access not in use with a list")
+	}
+}
+
+func TestQuic(t *testing.T) {
+	p := newQUic()
+	p.url = serveFile(t, "testdata/quic.html").URL
+	ipRanges, err := p.FetchIPRanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"192.0.2.10", "192.0.2.11", "198.51.100.7", "203.0.113.25", "203.0.113.26", "2001:db8:5::1"}
+	if !slices.Equal(ipRanges, want) {
+		t.Errorf("FetchIPRanges = %v; want %v", ipRanges, want)
+	}
+}
+
+func TestFastly(t *testing.T) {
+	p := newFastly()
+	p.url = serveFile(t, "testdata/fastly.json").URL
+	ipRanges, err := p.FetchIPRanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"23.235.32.0/20", "43.249.72.0/22", "103.244.50.0/24"}; !slices.Equal(ipRanges, want) {
+		t.Errorf("FetchIPRanges = %v; want %v", ipRanges, want)
+	}
+}
+
+func TestKey(t *testing.T) {
+	p := newKey()
+	p.url = serveFile(t, "testdata/key.json").URL
+	ipRanges, err := p.FetchIPRanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"2.16.0.0/24", "5.188.6.0/24", "2a02:6ea0:c000::/40"}; !slices.Equal(ipRanges, want) {
+		t.Errorf("FetchIPRanges = %v; want %v", ipRanges, want)
+	}
+}
+
+func TestYandex(t *testing.T) {
+	p := newYandex()
+	p.url = serveFile(t, "testdata/yandex.json").URL
+	ipRanges, err := p.FetchIPRanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"5.45.192.0/18", "87.250.224.0/19", "2a02:6b8::/29"}
+	if !slices.Equal(ipRanges, want) {
+		t.Errorf("FetchIPRanges = %v; want %v", ipRanges, want)
+	}
+}
+
+func TestSection(t *testing.T) {
+	want := []string{"151.101.0.0/16", "185.199.108.0/22", "2a04:4e42::/32"}
+	for _, fixture := range []string{"testdata/section.txt", "testdata/section.json"} {
+		p := newSection()
+		p.url = serveFile(t, fixture).URL
+		ipRanges, err := p.FetchIPRanges()
+		if err != nil {
+			t.Fatalf("%s: %v", fixture, err)
+		}
+		if !slices.Equal(ipRanges, want) {
+			t.Errorf("%s: FetchIPRanges = %v; want %v", fixture, ipRanges, want)
+		}
+	}
+}
+
+func TestMetricsHook(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	var c Counters
+	SetMetricsHook(&c)
+	defer SetMetricsHook(nil)
+
+	p := newStaticProvider("test", "192.0.2.0/24")
+	for i := 0; i < 3; i++ {
+		if _, err := p.FetchIPRangesWithCache(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ok, failed := c.Fetches("test"); ok != 1 || failed != 0 {
+		t.Errorf("Fetches = %d, %d; want 1, 0", ok, failed)
+	}
+	if r := c.CacheHitRatio("test"); r < 0.66 || r > 0.67 {
+		t.Errorf("CacheHitRatio = %v; want 2/3", r)
+	}
+
+	p.err = errors.New("boom")
+	p.cache = newCacheManager("failing")
+	_, _ = p.FetchIPRangesWithCache(context.Background())
+	if _, failed := c.Fetches("test"); failed != 1 {
+		t.Errorf("failed fetches = %d; want 1", failed)
+	}
+}
+
+func TestSetMetricsHookDuringFetches(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	defer SetMetricsHook(nil)
+	p := newStaticProvider("test", "192.0.2.0/24")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			p.fetchAndCache(p)
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		SetMetricsHook(new(Counters))
+	}
+	<-done
+}
+
+func TestConcurrentFetchIsCoalesced(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	p := newStaticProvider("test", "192.0.2.0/24")
+	p.delay = 50 * time.Millisecond
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := p.FetchIPRangesWithCache(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := p.calls.Load(); n != 1 {
+		t.Errorf("FetchIPRanges called %d times; want 1", n)
+	}
+}
+
+func TestMaxCDNHistoricalNeverExpires(t *testing.T) {
+	SetCacheDir(t.TempDir())
+	defer SetCacheDir("")
+	p := newMaxCDNHistorical()
+	ipRanges, err := p.FetchIPRanges()
+	if err != nil || len(ipRanges) == 0 {
+		t.Fatalf("FetchIPRanges = %v, %v", ipRanges, err)
+	}
+	if err := p.cache.store(cacheData{Timestamp: 1, IPRanges: ipRanges}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.cache.read(); err != nil {
+		t.Errorf("read of old cache: %v", err)
+	}
+}
+
+// defaultProviders returns Providers once the built-in providers are in it,
+// so that tests swapping it out restore them.
+func defaultProviders() map[string]provider {
+	builtinsLoaded.Do(loadBuiltins)
+	return Providers
+}
+
+func withProviders(t *testing.T, ps ...*staticProvider) {
+	t.Helper()
+	SetCacheDir(t.TempDir())
+	old := defaultProviders()
+	Providers = make(map[string]provider)
+	for _, p := range ps {
+		Providers[p.name] = p
+	}
+	resetStats()
+	t.Cleanup(func() {
+		Providers = old
+		SetCacheDir("")
+		resetStats()
+	})
+}
+
+// resetStats drops the default client's provider stats, which outlive the
+// providers of a test.
+func resetStats() {
+	defaultClient.statsMu.Lock()
+	defaultClient.stats = nil
+	defaultClient.statsMu.Unlock()
+}
+
+func TestCheckAll(t *testing.T) {
+	failing := newStaticProvider("failing")
+	failing.err = errors.New("unreachable")
+	withProviders(t,
+		newStaticProvider("a", "192.0.2.0/24"),
+		newStaticProvider("b", "198.51.100.0/24"),
+		failing,
+	)
+	result, err := CheckAll(context.Background(), net.ParseIP("192.0.2.10"))
+	want := map[string]bool{"a": true, "b": false, "failing": false}
+	if !maps.Equal(result, want) {
+		t.Errorf("CheckAll = %v; want %v", result, want)
+	}
+	if err == nil || !strings.Contains(err.Error(), "failing: unreachable") {
+		t.Errorf("CheckAll error = %v", err)
+	}
+}
+
+func TestWithCloudFrontIPLists(t *testing.T) {
+	p := newCloudFront()
+	p.url = serveFile(t, "testdata/cloudfront.json").URL
+
+	ipRanges, err := p.FetchIPRanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slices.Contains(ipRanges, "3.172.0.0/18") {
+		t.Error("origin-facing ranges included by default")
+	}
+
+	SetOptions(WithCloudFrontIPLists(CloudFrontGlobalIPList, CloudFrontOriginFacingIPList))
+	defer SetOptions(WithCloudFrontIPLists())
+	ipRanges, err = p.FetchIPRanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"3.172.0.0/18", "15.158.0.0/16", "120.52.22.96/27", "180.163.57.128/26", "204.246.168.0/22", "205.251.249.0/24", "2600:9000::/28"}
+	if !slices.Equal(ipRanges, want) {
+		t.Errorf("FetchIPRanges = %v; want %v", ipRanges, want)
+	}
+}
+
+func TestFetchCloudFrontIPLists(t *testing.T) {
+	p := newCloudFront()
+	p.url = serveFile(t, "testdata/cloudfront.json").URL
+	old := defaultProviders()
+	Providers = map[string]provider{CloudFront: p}
+	defer func() { Providers = old }()
+
+	ipRanges, err := FetchCloudFrontIPLists(CloudFrontOriginFacingIPList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"3.172.0.0/18", "15.158.0.0/16"}; !slices.Equal(ipRanges, want) {
+		t.Errorf("FetchCloudFrontIPLists = %v; want %v", ipRanges, want)
+	}
+	if ipRanges, err = p.FetchIPRanges(); err != nil || slices.Contains(ipRanges, "3.172.0.0/18") {
+		t.Errorf("provider ranges changed: %v, %v", ipRanges, err)
+	}
+}
+
+func TestSetMaxConcurrency(t *testing.T) {
+	restoreConfig(t)
+	defer SetMaxConcurrency(0)
+	gauge := new(inFlightGauge)
+	var ps []*staticProvider
+	for i := 0; i < 8; i++ {
+		p := newStaticProvider(fmt.Sprintf("p%d", i), fmt.Sprintf("10.%d.0.0/16", i))
+		p.delay = 20 * time.Millisecond
+		p.gauge = gauge
+		ps = append(ps, p)
+	}
+	withProviders(t, ps...)
+	SetMaxConcurrency(3)
+	PreCache()
+	if peak := gauge.reset(); peak > 3 || peak < 2 {
+		t.Errorf("PreCache ran %d fetches at once; want 2 or 3", peak)
+	}
+
+	SetCacheDir(t.TempDir())
+	for _, p := range ps {
+		cacheOf(p).evict()
+	}
+	SetMaxConcurrency(1)
+	SetOptions(WithBogonFilter(false))
+	if name := QueryName(net.ParseIP("10.7.0.1")); name != "p7" {
+		t.Errorf("QueryName = %q; want p7", name)
+	}
+	if peak := gauge.reset(); peak != 1 {
+		t.Errorf("QueryName ran %d fetches at once; want 1", peak)
+	}
+}
+
+func TestWithCachePermissions(t *testing.T) {
+	restoreConfig(t)
+	dir := filepath.Join(t.TempDir(), "cache")
+	SetCacheDir(dir)
+	SetOptions(WithCachePermissions(0600))
+	p := newStaticProvider("test", "192.0.2.0/24")
+	if _, err := p.FetchIPRangesWithCache(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	path, err := cacheOf(p).filePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]os.FileMode{path: 0600, dir: 0700} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := info.Mode().Perm(); mode != want {
+			t.Errorf("%s has mode %v; want %v", path, mode, want)
+		}
+	}
+}
+
+func TestWithoutDiskCache(t *testing.T) {
+	restoreConfig(t)
+	p := newStaticProvider("test", "192.0.2.0/24")
+	withProviders(t, p)
+	SetOptions(WithBogonFilter(false))
+	SetCacheDir("")
+	t.Setenv("HOME", "")
+	SetOptions(WithDiskCache(false))
+
+	if name := QueryName(net.ParseIP("192.0.2.1")); name != "test" {
+		t.Fatalf("QueryName = %q; want test", name)
+	}
+	if _, err := p.FetchIPRangesWithCache(context.Background()); err != nil {
+		t.Errorf("FetchIPRangesWithCache: %v", err)
+	}
+	if n := p.calls.Load(); n != 1 {
+		t.Errorf("fetched %d times; want the ranges kept in memory", n)
+	}
+	if cached := CachedProviders(); cached != nil {
+		t.Errorf("CachedProviders = %v; want nil", cached)
+	}
+}
+
+//go:embed testdata/fallback
+var fallbackFS embed.FS
+
+func TestWithFallbackFS(t *testing.T) {
+	restoreConfig(t)
+	offline := newStaticProvider("offline")
+	offline.err = errors.New("network unreachable")
+	unknown := newStaticProvider("unknown")
+	unknown.err = offline.err
+	withProviders(t, offline, unknown)
+	SetOptions(WithBogonFilter(false))
+
+	if _, err := offline.FetchIPRangesWithCache(context.Background()); err == nil {
+		t.Fatal("failed fetch succeeded without a fallback")
+	}
+	fsys, err := fs.Sub(fallbackFS, "testdata/fallback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetOptions(WithFallbackFS(fsys))
+	ipRanges, err := offline.FetchIPRangesWithCache(context.Background())
+	if want := []string{"192.0.2.0/24", "2001:db8::/32"}; err != nil || !slices.Equal(ipRanges, want) {
+		t.Errorf("FetchIPRangesWithCache = %v, %v; want the fallback %v", ipRanges, err, want)
+	}
+	if name := QueryName(net.ParseIP("192.0.2.1")); name != "offline" {
+		t.Errorf("QueryName = %q; want offline", name)
+	}
+	if cached := CachedProviders(); len(cached) != 0 {
+		t.Errorf("fallback ranges were cached for %v", cached)
+	}
+	if _, err := unknown.FetchIPRangesWithCache(context.Background()); !errors.Is(err, offline.err) {
+		t.Errorf("provider without a fallback file: err = %v; want the fetch error", err)
+	}
+
+	expired := []string{"198.51.100.0/24"}
+	old := time.Now().Add(-2 * defaultCacheTTL).Unix()
+	for _, p := range []*staticProvider{offline, unknown} {
+		if err := p.cache.store(cacheData{Timestamp: old, IPRanges: expired}); err != nil {
+			t.Fatal(err)
+		}
+		if ipRanges, err := p.FetchIPRangesWithCache(context.Background()); err != nil || !slices.Equal(ipRanges, expired) {
+			t.Errorf("%s with an expired cache: %v, %v; want the expired ranges", p.name, ipRanges, err)
+		}
+	}
+}
+
+func TestPreCacheStale(t *testing.T) {
+	restoreConfig(t)
+	stale := newStaticProvider("stale", "192.0.2.0/24")
+	fresh := newStaticProvider("fresh", "198.51.100.0/24")
+	missing := newStaticProvider("missing", "203.0.113.0/24")
+	failing := newStaticProvider("failing")
+	failing.err = errors.New("unreachable")
+	withProviders(t, stale, fresh, missing, failing)
+	SetStaleWhileRevalidate(true)
+	old := time.Now().Add(-2 * defaultCacheTTL).Unix()
+	if err := stale.cache.store(cacheData{Timestamp: old, IPRanges: []string{"192.0.2.0/25"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fresh.cache.write(fresh.ranges, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := PreCacheStale()
+	if len(errs) != 3 || errs["stale"] != nil || errs["missing"] != nil || errs["failing"] == nil {
+		t.Errorf("PreCacheStale = %v", errs)
+	}
+	if _, ok := errs["fresh"]; ok || fresh.calls.Load() != 0 {
+		t.Errorf("fresh provider refreshed %d times", fresh.calls.Load())
+	}
+	for _, p := range []*staticProvider{stale, missing} {
+		if n := p.calls.Load(); n != 1 {
+			t.Errorf("%s fetched %d times; want 1", p.name, n)
+		}
+		if ranges, err := p.cache.read(); err != nil || !slices.Equal(ranges, p.ranges) {
+			t.Errorf("%s cache = %v, %v", p.name, ranges, err)
+		}
+	}
+}
+
+func TestWarmStart(t *testing.T) {
+	stale := newStaticProvider("stale", "192.0.2.0/24")
+	stale.delay = 200 * time.Millisecond
+	fresh := newStaticProvider("fresh", "198.51.100.0/24")
+	missing := newStaticProvider("missing", "203.0.113.0/24")
+	withProviders(t, stale, fresh, missing)
+	old := time.Now().Add(-2 * defaultCacheTTL).Unix()
+	if err := stale.cache.store(cacheData{Timestamp: old, IPRanges: []string{"192.0.2.0/25"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fresh.cache.write(fresh.ranges, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	got := WarmStart(context.Background())
+	if elapsed := time.Since(start); elapsed >= stale.delay {
+		t.Errorf("WarmStart took %v; want it not to wait for refreshes", elapsed)
+	}
+	want := map[string][]string{"stale": {"192.0.2.0/25"}, "fresh": {"198.51.100.0/24"}}
+	if !maps.EqualFunc(got, want, slices.Equal[[]string]) {
+		t.Errorf("WarmStart = %v; want %v", got, want)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for _, p := range []*staticProvider{stale, missing} {
+		for {
+			ranges, err := p.cache.read()
+			if err == nil && slices.Equal(ranges, p.ranges) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s was not refreshed: %v, %v", p.name, ranges, err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if n := fresh.calls.Load(); n != 0 {
+		t.Errorf("fresh provider fetched %d times", n)
+	}
+}
+
+func TestFetchIPRangesWithCacheContext(t *testing.T) {
+	p := newStaticProvider("slow", "192.0.2.0/24")
+	p.delay = 200 * time.Millisecond
+	withProviders(t, p)
+	pro, err := GetProvider("slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := pro.FetchIPRangesWithCache(canceled); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled: error = %v; want context.Canceled", err)
+	}
+	if n := p.calls.Load(); n != 0 {
+		t.Errorf("canceled: fetched %d times", n)
+	}
+
+	// A caller that gives up doesn't cancel a fetch another one waits for.
+	waited := make(chan []string)
+	go func() {
+		ranges, _ := pro.FetchIPRangesWithCache(context.Background())
+		waited <- ranges
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := pro.FetchIPRangesWithCache(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("timeout: error = %v; want context.DeadlineExceeded", err)
+	}
+	if ranges := <-waited; !slices.Equal(ranges, p.ranges) {
+		t.Errorf("FetchIPRangesWithCache = %v; want %v", ranges, p.ranges)
+	}
+	if n := p.calls.Load(); n != 1 {
+		t.Errorf("fetched %d times; want 1", n)
+	}
+}
+
+func TestFetchCancelledWithContext(t *testing.T) {
+	restoreConfig(t)
+	SetOptions(WithAllowInsecureHTTP(true))
+	cancelled := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(cancelled)
+	}))
+	t.Cleanup(srv.Close)
+	p := newCloudFlareAccess()
+	p.url = srv.URL
+	withProviders(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := p.FetchIPRangesWithCache(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v; want context.DeadlineExceeded", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request still running after the caller gave up")
+	}
+}
+
+func TestDirectFetchOutlivesRefresh(t *testing.T) {
+	restoreConfig(t)
+	SetOptions(WithAllowInsecureHTTP(true))
+	started, release := make(chan struct{}, 2), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		select {
+		case <-release:
+			fmt.Fprintln(w, "192.0.2.0/24")
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(srv.Close)
+	p := newCloudFlareAccess()
+	p.url = srv.URL
+	withProviders(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	refreshErr := make(chan error, 1)
+	go func() {
+		_, err := p.FetchIPRangesWithCache(ctx)
+		refreshErr <- err
+	}()
+	<-started
+	direct := make(chan error, 1)
+	go func() {
+		_, err := p.FetchIPRanges()
+		direct <- err
+	}()
+	<-started
+	cancel()
+	if err := <-refreshErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("refresh error = %v; want context.Canceled", err)
+	}
+	close(release)
+	if err := <-direct; err != nil {
+		t.Errorf("direct fetch cancelled with the refresh: %v", err)
+	}
+}
+
+func TestSharedCloudFrontFetchOutlivesCaller(t *testing.T) {
+	restoreConfig(t)
+	SetOptions(WithAllowInsecureHTTP(true), WithMinRanges(CloudFront, 0), WithMinRanges(CloudFrontRegional, 0))
+	var requests atomic.Int32
+	started, release := make(chan struct{}, 2), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		started <- struct{}{}
+		select {
+		case <-release:
+			http.ServeFile(w, r, "testdata/cloudfront.json")
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(srv.Close)
+	cf, regional := newCloudFront(), newCloudFrontRegional()
+	cf.url, regional.url = srv.URL, srv.URL
+	withProviders(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cfErr := make(chan error, 1)
+	go func() {
+		_, err := cf.FetchIPRangesWithCache(ctx)
+		cfErr <- err
+	}()
+	<-started
+	regionalErr := make(chan error, 1)
+	go func() {
+		_, err := regional.FetchIPRangesWithCache(context.Background())
+		regionalErr <- err
+	}()
+	time.Sleep(50 * time.Millisecond) // let regional join the request
+	cancel()
+	if err := <-cfErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("cloudfront error = %v; want context.Canceled", err)
+	}
+	close(release)
+	if err := <-regionalErr; err != nil {
+		t.Errorf("cloudfront-regional failed with the cloudfront refresh: %v", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("%d requests; want one shared", n)
+	}
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	restoreConfig(t)
+	p := newStaticProvider("swr", "192.0.2.0/24")
+	p.delay = 200 * time.Millisecond
+	withProviders(t, p)
+	old := time.Now().Add(-2 * defaultCacheTTL).Unix()
+	if err := p.cache.store(cacheData{Timestamp: old, IPRanges: []string{"192.0.2.0/25"}}); err != nil {
+		t.Fatal(err)
+	}
+	SetStaleWhileRevalidate(true)
+
+	start := time.Now()
+	ranges, err := p.FetchIPRangesWithCache(context.Background())
+	if elapsed := time.Since(start); elapsed >= p.delay {
+		t.Errorf("FetchIPRangesWithCache took %v; want the stale ranges at once", elapsed)
+	}
+	if err != nil || !slices.Equal(ranges, []string{"192.0.2.0/25"}) {
+		t.Errorf("FetchIPRangesWithCache = %v, %v; want the stale ranges", ranges, err)
+	}
+	p.FetchIPRangesWithCache(context.Background())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ranges, err := p.cache.read()
+		if err == nil && slices.Equal(ranges, p.ranges) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("cache was not refreshed: %v, %v", ranges, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := p.calls.Load(); n != 1 {
+		t.Errorf("provider fetched %d times; want one background refresh", n)
+	}
+}
+
+func TestFetchIPRangesStaleWhileRevalidate(t *testing.T) {
+	restoreConfig(t)
+	stale := newStaticProvider("stale", "192.0.2.0/24")
+	stale.delay = 200 * time.Millisecond
+	fresh := newStaticProvider("fresh", "198.51.100.0/24")
+	missing := newStaticProvider("missing", "203.0.113.0/24")
+	missing.delay = 200 * time.Millisecond
+	withProviders(t, stale, fresh, missing)
+	old := time.Now().Add(-2 * defaultCacheTTL).Unix()
+	if err := stale.cache.store(cacheData{Timestamp: old, IPRanges: []string{"192.0.2.0/25"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fresh.cache.write(fresh.ranges, ""); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		ranges, isStale, err := FetchIPRangesStaleWhileRevalidate(ctx, "stale")
+		if err != nil || !isStale || !slices.Equal(ranges, []string{"192.0.2.0/25"}) {
+			t.Errorf("stale provider = %v, %v, %v", ranges, isStale, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed >= stale.delay {
+		t.Errorf("stale ranges took %v; want them at once", elapsed)
+	}
+	if ranges, isStale, err := FetchIPRangesStaleWhileRevalidate(ctx, "fresh"); err != nil || isStale || !slices.Equal(ranges, fresh.ranges) {
+		t.Errorf("fresh provider = %v, %v, %v", ranges, isStale, err)
+	}
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := FetchIPRangesStaleWhileRevalidate(short, "missing"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("missing provider with a short deadline: err = %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for _, p := range []*staticProvider{stale, missing} {
+		for {
+			ranges, err := p.cache.read()
+			if err == nil && slices.Equal(ranges, p.ranges) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s was not refreshed: %v, %v", p.name, ranges, err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if n := p.calls.Load(); n != 1 {
+			t.Errorf("%s fetched %d times; want 1", p.name, n)
+		}
+	}
+	if ranges, isStale, err := FetchIPRangesStaleWhileRevalidate(ctx, "stale"); err != nil || isStale || !slices.Equal(ranges, stale.ranges) {
+		t.Errorf("after the refresh = %v, %v, %v", ranges, isStale, err)
+	}
+}
+
+func TestWithGCoreLists(t *testing.T) {
+	restoreConfig(t)
+	p := newGCore()
+	p.url = serveFile(t, "testdata/gcore-cdn.json").URL
+	p.listURLs[GCoreStreamingIPList] = serveFile(t, "testdata/gcore-streaming.json").URL
+
+	ipRanges, err := p.FetchIPRanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"92.223.84.0/24", "93.123.11.0/24"}; !slices.Equal(ipRanges, want) {
+		t.Errorf("default FetchIPRanges = %v; want %v", ipRanges, want)
+	}
+
+	SetOptions(WithGCoreLists(GCoreStreamingIPList, "unknown"))
+	ipRanges, err = p.FetchIPRanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"5.188.7.0/24", "92.223.84.0/24", "93.123.11.0/24", "185.101.137.0/24"}
+	if !slices.Equal(ipRanges, want) {
+		t.Errorf("FetchIPRanges = %v; want %v", ipRanges, want)
+	}
+}
+
+func TestQueryNameWithNetwork(t *testing.T) {
+	restoreConfig(t)
+	withProviders(t,
+		newStaticProvider("a", "192.0.2.0/24"),
+		newStaticProvider("b", "198.51.100.0/25", "198.51.100.128/25"),
+	)
+	SetOptions(WithBogonFilter(false))
+	ip := net.ParseIP("198.51.100.200")
+	name, network := QueryNameWithNetwork(ip)
+	if name != "b" || network == nil || !network.Contains(ip) {
+		t.Errorf("QueryNameWithNetwork(%s) = %q, %v; want b and a network containing it", ip, name, network)
+	}
+	if name, network = QueryNameWithNetwork(net.ParseIP("203.0.113.1")); name != "" || network != nil {
+		t.Errorf("QueryNameWithNetwork without match = %q, %v", name, network)
+	}
+}
+
+func TestQueryNameInvalidIP(t *testing.T) {
+	restoreConfig(t)
+	p := newStaticProvider("a", "192.0.2.0/24")
+	withProviders(t, p)
+	SetOptions(WithBogonFilter(false))
+	for _, ip := range []net.IP{nil, net.ParseIP("not-an-ip"), {192, 0, 2}} {
+		if name, network := QueryNameWithNetwork(ip); name != "" || network != nil {
+			t.Errorf("QueryNameWithNetwork(%v) = %q, %v", []byte(ip), name, network)
+		}
+	}
+	if n := p.calls.Load(); n != 0 {
+		t.Errorf("invalid input fetched ranges %d times", n)
+	}
+	if _, err := CheckAll(context.Background(), nil); !errors.Is(err, ErrInvalidIP) {
+		t.Errorf("CheckAll(nil) error = %v; want ErrInvalidIP", err)
+	}
+	for _, ip := range []net.IP{net.ParseIP("::ffff:192.0.2.1"), net.ParseIP("192.0.2.1").To4()} {
+		if name := QueryName(ip); name != "a" {
+			t.Errorf("QueryName(%s) = %q; want a", ip, name)
+		}
+	}
+}
+
+func TestQueryNameAddressForms(t *testing.T) {
+	restoreConfig(t)
+	withProviders(t,
+		newStaticProvider("cloudflare", "104.16.0.0/13", "2606:4700::/32"),
+		newStaticProvider("link-local", "fe80::/10"),
+	)
+	for _, tt := range []struct {
+		addr, want string
+	}{
+		{"104.16.1.1", "cloudflare"},
+		{"::ffff:104.16.1.1", "cloudflare"},
+		{"::FFFF:104.16.1.1", "cloudflare"},
+		{"::ffff:6810:101", "cloudflare"},
+		{"[::ffff:104.16.1.1]", "cloudflare"},
+		{"2606:4700::6810:101", "cloudflare"},
+		{"[2606:4700::6810:101]", "cloudflare"},
+		{"2606:4700::6810:101%eth0", "cloudflare"},
+		{"fe80::1%eth0", ""},
+		{"104.24.0.1", ""},
+		{"::104.16.1.1", ""},
+		{"64:ff9b::104.16.1.1", ""},
+		{"104.16.1.1%eth0", ""},
+	} {
+		if got := QueryName(ParseIP(tt.addr)); got != tt.want {
+			t.Errorf("QueryName(ParseIP(%q)) = %q; want %q", tt.addr, got, tt.want)
+		}
+	}
+	SetOptions(WithBogonFilter(false))
+	for _, addr := range []string{"fe80::1%eth0", "fe80::1%25en0"} {
+		if got := QueryName(ParseIP(addr)); got != "link-local" {
+			t.Errorf("without the bogon filter QueryName(ParseIP(%q)) = %q; want link-local", addr, got)
+		}
+	}
+	if ip := ParseIP("::ffff:104.16.1.1"); len(ip) != net.IPv4len {
+		t.Errorf("ParseIP of a mapped address = %v of length %d; want the 4-byte form", []byte(ip), len(ip))
+	}
+	if ip := ParseIP("not-an-ip%eth0"); ip != nil {
+		t.Errorf("ParseIP of garbage = %v; want nil", ip)
+	}
+}
+
+func TestCacheFileFormats(t *testing.T) {
+	SetCacheDir(t.TempDir())
+	defer SetCacheDir("")
+	now := time.Now().Unix()
+	for _, format := range []struct {
+		file, provider, sourceURL string
+	}{
+		{fmt.Sprintf(`{"Timestamp": %d, "IPRanges": ["192.0.2.0/24"]}`, now), "", ""},
+		{fmt.Sprintf(`{"Provider": "test", "SourceURL": "https://example.com/ips", "Timestamp": %d, "IPRanges": ["192.0.2.0/24"]}`, now), "test", "https://example.com/ips"},
+	} {
+		cm := newCacheManager("test")
+		path, err := cm.filePath()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(path, []byte(format.file), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cache, _, err := cm.load()
+		if err != nil {
+			t.Fatalf("%s: %v", format.file, err)
+		}
+		if cache.Provider != format.provider || cache.SourceURL != format.sourceURL || !slices.Equal(cache.IPRanges, []string{"192.0.2.0/24"}) {
+			t.Errorf("%s: loaded %+v", format.file, cache)
+		}
+	}
+
+	p := newStaticProvider("written", "198.51.100.0/24")
+	if _, err := p.FetchIPRangesWithCache(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	cache, _, err := p.cache.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache.Provider != "written" || cache.SourceURL != p.url {
+		t.Errorf("written cache file describes %q from %q", cache.Provider, cache.SourceURL)
+	}
+}
+
+func TestCacheValidatedOnRead(t *testing.T) {
+	restoreConfig(t)
+	SetCacheDir(t.TempDir())
+	now := time.Now().Unix()
+	p := newStaticProvider("test", "203.0.113.0/24")
+	path, err := p.cache.filePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := fmt.Sprintf(`{"Timestamp": %d, "IPRanges": ["198.51.100.0/24", "2001:0DB8::/32", "192.0.2.0/24", "192.0.2.0/24", "oops"]}`, now)
+	if err = os.WriteFile(path, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	SetOptions(WithMaxInvalidCacheFraction(0.5))
+	cache, err := newCacheManager("test").current()
+	if want := []string{"192.0.2.0/24", "198.51.100.0/24", "2001:db8::/32"}; err != nil || !slices.Equal(cache.IPRanges, want) {
+		t.Errorf("current = %v, %v; want %v", cache.IPRanges, err, want)
+	}
+
+	SetOptions(WithMaxInvalidCacheFraction(0.1))
+	if _, err := newCacheManager("test").current(); !errors.Is(err, ErrCacheCorrupt) {
+		t.Errorf("current error = %v; want ErrCacheCorrupt", err)
+	}
+	if ranges, err := p.FetchIPRangesWithCache(context.Background()); err != nil || !slices.Equal(ranges, []string{"203.0.113.0/24"}) {
+		t.Errorf("FetchIPRangesWithCache = %v, %v; want the ranges refetched", ranges, err)
+	}
+}
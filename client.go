@@ -0,0 +1,130 @@
+package cdn
+
+import (
+	"fmt"
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/time/rate"
+	"maps"
+	"net/http"
+	"sync"
+)
+
+// Client is an independent set of providers with its own settings, HTTP
+// client and in-memory cache, for programs that need differently configured
+// lookups side by side. The package-level functions use a default Client
+// whose providers are those in Providers. Logging, metrics and the ASN
+// resolver are shared by all clients, as are cache files when two clients
+// use the same cache directory.
+type Client struct {
+	mu   sync.RWMutex
+	conf config
+	// explicit holds the options applied with SetOptions, which LoadRC
+	// replays over the settings of ~/.cdnrc so that they take precedence,
+	// and explicitURLs the providers whose URL was set with SetProviderURL.
+	explicit     []Option
+	explicitURLs map[string]bool
+
+	httpMu       sync.Mutex
+	httpc        *http.Client
+	providerHTTP map[string]*http.Client
+
+	limitMu  sync.Mutex
+	limiters map[string]*rate.Limiter
+
+	statsMu sync.Mutex
+	stats   map[string]ProviderStats
+
+	lookups lookupCache
+
+	// webhooks tracks the webhook deliveries in progress.
+	webhooks sync.WaitGroup
+
+	// providers is nil for the default client, which uses Providers. The
+	// map is replaced rather than modified, so a map obtained from registry
+	// can be iterated without holding regMu.
+	regMu     sync.RWMutex
+	providers map[string]provider
+	// fetches coalesces concurrent requests for sources that several
+	// providers share, such as the CloudFront list.
+	fetches singleflight.Group
+}
+
+var defaultClient = &Client{conf: defaultConfig()}
+
+// NewClient returns a Client with its own instances of the built-in
+// providers, configured by the settings of ~/.cdnrc, if any, and opts, which
+// take precedence. An invalid ~/.cdnrc is logged and ignored.
+func NewClient(opts ...Option) *Client {
+	cl := &Client{conf: defaultConfig(), providers: builtinProviders()}
+	for _, pro := range cl.providers {
+		if b, ok := pro.(interface{ bind(*Client) }); ok {
+			b.bind(cl)
+		}
+	}
+	if err := cl.LoadRC(); err != nil {
+		logger().Warn("ignoring .cdnrc", "error", err)
+	}
+	cl.SetOptions(opts...)
+	return cl
+}
+
+// registry returns a snapshot of the client's providers, which must not be
+// modified.
+func (cl *Client) registry() map[string]provider {
+	if cl == defaultClient {
+		builtinsLoaded.Do(loadBuiltins)
+	}
+	cl.regMu.RLock()
+	defer cl.regMu.RUnlock()
+	if cl.providers == nil {
+		return Providers
+	}
+	return cl.providers
+}
+
+// RegisterProvider adds p to the default client; see
+// Client.RegisterProvider.
+func RegisterProvider(name string, p provider) error {
+	return defaultClient.RegisterProvider(name, p)
+}
+
+// RegisterProvider adds p under name, replacing any provider of that name.
+// Its source URLs must use https unless WithAllowInsecureHTTP is set, as
+// with SetProviderURL. It is safe to call while lookups are running; those
+// already running keep the providers they started with.
+func (cl *Client) RegisterProvider(name string, p provider) error {
+	if err := cl.validateProviderSources(p); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if b, ok := p.(interface{ bind(*Client) }); ok {
+		b.bind(cl)
+	}
+	if cl == defaultClient {
+		builtinsLoaded.Do(loadBuiltins)
+	}
+	cl.regMu.Lock()
+	defer cl.regMu.Unlock()
+	if cl.providers == nil {
+		Providers = withProvider(Providers, name, p)
+	} else {
+		cl.providers = withProvider(cl.providers, name, p)
+	}
+	cl.lookups.clear()
+	return nil
+}
+
+// withProvider returns a copy of registry with p added under name.
+func withProvider(registry map[string]provider, name string, p provider) map[string]provider {
+	registry = maps.Clone(registry)
+	if registry == nil {
+		registry = make(map[string]provider)
+	}
+	registry[name] = p
+	return registry
+}
+
+func (cl *Client) config() config {
+	cl.mu.RLock()
+	defer cl.mu.RUnlock()
+	return cl.conf
+}
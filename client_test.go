@@ -0,0 +1,140 @@
+package cdn
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func serveText(t *testing.T, body string) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestClientsAreIsolated(t *testing.T) {
+	defaultURL := defaultProviders()[CloudFlare].(*cloudFlare).url
+	dirA, dirB := t.TempDir(), t.TempDir()
+
+	a := NewClient(WithAllowInsecureHTTP(true), WithMinRanges(CloudFlare, 0), WithBogonFilter(false))
+	if err := a.Configure(Options{CacheDir: dirA, CacheTTL: time.Hour, Providers: []string{CloudFlare}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SetProviderURL(CloudFlare, serveText(t, "192.0.2.0/24\n")); err != nil {
+		t.Fatal(err)
+	}
+	b := NewClient(WithAllowInsecureHTTP(true), WithMinRanges(CloudFlare, 0), WithBogonFilter(false))
+	if err := b.Configure(Options{CacheDir: dirB, Providers: []string{CloudFlare}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetProviderURL(CloudFlare, serveText(t, "198.51.100.0/24\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	ip := net.ParseIP("192.0.2.1")
+	if name := a.QueryName(ip); name != CloudFlare {
+		t.Errorf("a.QueryName = %q; want %q", name, CloudFlare)
+	}
+	if name := b.QueryName(ip); name != "" {
+		t.Errorf("b.QueryName = %q; want no match", name)
+	}
+	if got := a.CachedProviders(); !slices.Equal(got, []string{CloudFlare}) {
+		t.Errorf("a.CachedProviders = %v", got)
+	}
+	if _, err := os.Stat(filepath.Join(dirB, ".cloudflare.cdn.ip.range")); err != nil {
+		t.Errorf("b did not write its own cache: %v", err)
+	}
+
+	if url := defaultProviders()[CloudFlare].(*cloudFlare).url; url != defaultURL {
+		t.Errorf("default cloudflare URL changed to %s", url)
+	}
+	if ttl := CurrentOptions().CacheTTL; ttl != defaultCacheTTL {
+		t.Errorf("default CacheTTL changed to %v", ttl)
+	}
+	if ttl := b.CurrentOptions().CacheTTL; ttl != defaultCacheTTL {
+		t.Errorf("b.CacheTTL = %v; want the default", ttl)
+	}
+}
+
+func TestRegisterProviderDuringQueries(t *testing.T) {
+	restoreConfig(t)
+	withProviders(t, newStaticProvider("a", "192.0.2.0/24"))
+	SetOptions(WithBogonFilter(false))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			name := fmt.Sprintf("p%d", i)
+			if err := RegisterProvider(name, newStaticProvider(name, "198.51.100.0/24")); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	ip := net.ParseIP("192.0.2.1")
+	for i := 0; i < 50; i++ {
+		if name := QueryName(ip); name != "a" {
+			t.Errorf("QueryName = %q; want a", name)
+		}
+		PreCache()
+	}
+	<-done
+	if n := len(defaultProviders()); n != 51 {
+		t.Errorf("%d providers registered; want 51", n)
+	}
+}
+
+func TestProviderNames(t *testing.T) {
+	withProviders(t, newStaticProvider("b"), newStaticProvider("a"))
+	if names := ProviderNames(); !slices.Equal(names, []string{"a", "b"}) {
+		t.Errorf("ProviderNames = %v; want [a b]", names)
+	}
+	names := NewClient().ProviderNames()
+	if !slices.IsSorted(names) || !slices.Contains(names, Akamai) || !slices.Contains(names, CloudFlareAccess) {
+		t.Errorf("NewClient().ProviderNames = %v; want all built-in providers, sorted", names)
+	}
+}
+
+func TestLoadBuiltinsKeepsProviders(t *testing.T) {
+	old := defaultProviders()
+	t.Cleanup(func() { Providers = old })
+	custom, cf := newStaticProvider("custom"), newStaticProvider(CloudFlare)
+	Providers = map[string]provider{"custom": custom, CloudFlare: cf}
+	loadBuiltins()
+	if Providers["custom"] != provider(custom) || Providers[CloudFlare] != provider(cf) {
+		t.Error("loadBuiltins replaced providers added before it")
+	}
+	if _, ok := Providers[Akamai].(*akamai); !ok {
+		t.Errorf("Providers[%s] = %T; want *akamai", Akamai, Providers[Akamai])
+	}
+}
+
+func TestRegisterProviderValidatesURL(t *testing.T) {
+	restoreConfig(t)
+	withProviders(t)
+	p := newStaticProvider("plain")
+	p.url = "http://example.com/plain.txt"
+	if err := RegisterProvider("plain", p); err == nil {
+		t.Error("http source accepted")
+	}
+	p.url = "https://example.com/plain.txt"
+	p.fallbackURL = "http://example.com/plain.txt"
+	if err := RegisterProvider("plain", p); err == nil {
+		t.Error("http fallback accepted")
+	}
+	if _, err := GetProvider("plain"); err == nil {
+		t.Error("rejected provider was registered")
+	}
+	SetOptions(WithAllowInsecureHTTP(true))
+	if err := RegisterProvider("plain", p); err != nil {
+		t.Errorf("http source with WithAllowInsecureHTTP: %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package cdn
+
+import "net"
+
+// DiffRanges returns the entries of newRanges missing from oldRanges and
+// those of oldRanges missing from newRanges, in input order. Entries are
+// compared in normalized form, so 10.0.0.7/24 equals 10.0.0.0/24,
+// 2001:DB8::/32 equals 2001:db8::/32 and a bare address equals its host
+// range; entries that don't parse are compared as they are. Each difference
+// is reported once, in the spelling it first appears with.
+func DiffRanges(oldRanges, newRanges []string) (added, removed []string) {
+	return missingRanges(newRanges, oldRanges), missingRanges(oldRanges, newRanges)
+}
+
+// missingRanges returns the entries of ipRanges that aren't in other.
+func missingRanges(ipRanges, other []string) []string {
+	skip := make(map[string]bool, len(other))
+	for _, r := range other {
+		skip[normalizeRange(r)] = true
+	}
+	var result []string
+	for _, r := range ipRanges {
+		key := normalizeRange(r)
+		if !skip[key] {
+			result = append(result, r)
+			skip[key] = true
+		}
+	}
+	return result
+}
+
+func normalizeRange(r string) string {
+	if _, cidr, err := net.ParseCIDR(r); err == nil {
+		return cidr.String()
+	}
+	if ip := net.ParseIP(r); ip != nil {
+		return hostNet(ip).String()
+	}
+	return r
+}
@@ -0,0 +1,51 @@
+package cdn
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiffRanges(t *testing.T) {
+	tests := []struct {
+		name           string
+		old, new       []string
+		added, removed []string
+	}{
+		{
+			name:  "added",
+			old:   []string{"192.0.2.0/24"},
+			new:   []string{"192.0.2.0/24", "198.51.100.0/24", "2001:db8::/32"},
+			added: []string{"198.51.100.0/24", "2001:db8::/32"},
+		},
+		{
+			name:    "removed",
+			old:     []string{"192.0.2.0/24", "198.51.100.0/24", "203.0.113.0/24"},
+			new:     []string{"198.51.100.0/24"},
+			removed: []string{"192.0.2.0/24", "203.0.113.0/24"},
+		},
+		{
+			name:    "both",
+			old:     []string{"192.0.2.0/24", "198.51.100.0/24"},
+			new:     []string{"198.51.100.0/24", "203.0.113.0/24"},
+			added:   []string{"203.0.113.0/24"},
+			removed: []string{"192.0.2.0/24"},
+		},
+		{
+			name: "reordered and reformatted",
+			old:  []string{"10.0.0.0/24", "2001:db8::/32", "192.0.2.1", "198.51.100.0/24"},
+			new:  []string{"198.51.100.0/24", "192.0.2.1/32", "2001:DB8:0::/32", "10.0.0.7/24", "10.0.0.0/24"},
+		},
+		{
+			name:  "duplicates",
+			old:   nil,
+			new:   []string{"192.0.2.0/24", "192.0.2.0/24", "junk", "junk"},
+			added: []string{"192.0.2.0/24", "junk"},
+		},
+	}
+	for _, tt := range tests {
+		added, removed := DiffRanges(tt.old, tt.new)
+		if !slices.Equal(added, tt.added) || !slices.Equal(removed, tt.removed) {
+			t.Errorf("%s: DiffRanges = %v, %v; want %v, %v", tt.name, added, removed, tt.added, tt.removed)
+		}
+	}
+}
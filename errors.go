@@ -0,0 +1,54 @@
+package cdn
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrProviderNotFound is returned for a provider name that isn't
+	// registered.
+	ErrProviderNotFound = errors.New("CDN provider not found")
+	// ErrCacheMiss is returned when a provider has no cache file yet.
+	ErrCacheMiss = errors.New("cache miss")
+	// ErrCacheExpired is returned when a provider's cached ranges are older
+	// than the cache TTL.
+	ErrCacheExpired = errors.New("cache expired")
+	// ErrCacheCorrupt is returned when more of a cache file's entries are
+	// invalid than WithMaxInvalidCacheFraction allows, e.g. in a hand-edited
+	// file. The ranges are then refetched.
+	ErrCacheCorrupt = errors.New("cache corrupt")
+	// ErrNoValidRanges is returned when a provider's source yields no valid
+	// CIDR or IP address.
+	ErrNoValidRanges = errors.New("no valid IP ranges")
+	// ErrTooFewRanges is returned when a provider's source yields fewer
+	// ranges than the provider is known to publish, which usually means its
+	// format changed. The cached ranges are kept.
+	ErrTooFewRanges = errors.New("too few IP ranges")
+	// ErrInvalidIP is returned for an IP that is nil or of the wrong length,
+	// such as the result of net.ParseIP on a malformed address.
+	ErrInvalidIP = errors.New("invalid IP address")
+	// ErrUnexpectedFormat is returned when a provider's response is not in
+	// the format its source is known to use: a JSON response lacking a key,
+	// which usually means it was renamed, or an HTML page where a plain-text
+	// list is expected, such as a challenge page.
+	ErrUnexpectedFormat = errors.New("unexpected response format")
+)
+
+// FetchError describes a failure to fetch a provider's ranges: a network
+// error, an unexpected HTTP status or a response that couldn't be parsed.
+// StatusCode is set for unexpected statuses and zero otherwise.
+type FetchError struct {
+	Provider   string
+	URL        string
+	StatusCode int
+	Err        error
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("%s: %s: %v", e.Provider, e.URL, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
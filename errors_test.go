@@ -0,0 +1,57 @@
+package cdn
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTypedErrors(t *testing.T) {
+	if _, err := GetProvider("nope"); !errors.Is(err, ErrProviderNotFound) {
+		t.Errorf("GetProvider: err = %v; want ErrProviderNotFound", err)
+	}
+	if err := SetEnabledProviders("nope"); !errors.Is(err, ErrProviderNotFound) {
+		t.Errorf("SetEnabledProviders: err = %v; want ErrProviderNotFound", err)
+	}
+
+	p := newStaticProvider("test", "192.0.2.0/24")
+	withProviders(t, p)
+	if _, err := p.cache.read(); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("read without cache file: err = %v; want ErrCacheMiss", err)
+	}
+	old := time.Now().Add(-2 * defaultCacheTTL).Unix()
+	if err := p.cache.store(cacheData{Timestamp: old, IPRanges: p.ranges}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.cache.read(); !errors.Is(err, ErrCacheExpired) {
+		t.Errorf("read of old cache: err = %v; want ErrCacheExpired", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/unavailable", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "try later", http.StatusServiceUnavailable)
+	})
+	mux.HandleFunc("/maintenance", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>maintenance</html>\n"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	cf := newCloudFlare()
+	cf.url = srv.URL + "/unavailable"
+	_, err := cf.FetchIPRanges()
+	var fetchErr *FetchError
+	if !errors.As(err, &fetchErr) {
+		t.Fatalf("err = %v; want a *FetchError", err)
+	}
+	if fetchErr.Provider != CloudFlare || fetchErr.URL != cf.url || fetchErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("FetchError = %+v", fetchErr)
+	}
+
+	cf.url = srv.URL + "/maintenance"
+	_, err = cf.FetchIPRanges()
+	if !errors.As(err, &fetchErr) || !errors.Is(err, ErrNoValidRanges) {
+		t.Errorf("err = %v; want a *FetchError wrapping ErrNoValidRanges", err)
+	}
+}
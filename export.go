@@ -0,0 +1,86 @@
+package cdn
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// AllRanges returns the ranges of every provider of the default client; see
+// Client.AllRanges.
+func AllRanges() (map[string][]string, error) {
+	return defaultClient.AllRanges()
+}
+
+// AllRanges returns the ranges of every provider in use, keyed by provider
+// name, fetching them through the cache in parallel up to the limit set
+// with SetMaxConcurrency. A provider that fails is left out and its error
+// is included in the returned error, which joins all failures in the order
+// of the provider names.
+func (cl *Client) AllRanges() (map[string][]string, error) {
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		result = make(map[string][]string)
+		errs   = make(map[string]error)
+	)
+	sem := newSemaphore(cl.config().maxConcurrency)
+	for name, pro := range cl.activeProviders() {
+		wg.Add(1)
+		go func(name string, pro provider) {
+			defer wg.Done()
+			sem.acquire()
+			defer sem.release()
+			ipRanges, err := pro.FetchIPRangesWithCache(context.Background())
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[name] = fmt.Errorf("%s: %w", name, err)
+				return
+			}
+			result[name] = ipRanges
+		}(name, pro)
+	}
+	wg.Wait()
+	var joined []error
+	for _, name := range cl.activeProviderNames() {
+		if err := errs[name]; err != nil {
+			joined = append(joined, err)
+		}
+	}
+	return result, errors.Join(joined...)
+}
+
+// ExportCombined writes the ranges of every provider of the default client
+// to w; see Client.ExportCombined.
+func ExportCombined(w io.Writer) error {
+	return defaultClient.ExportCombined(w)
+}
+
+// ExportCombined writes the ranges of every provider in use to w in CIDR
+// notation, one per line, under a "# <provider>" comment line per provider.
+// Providers appear in the order of their names and ranges in canonical
+// order, so the output only changes when the ranges do. Providers that fail
+// are left out, as by AllRanges, and their errors returned after the rest
+// is written.
+func (cl *Client) ExportCombined(w io.Writer) error {
+	all, fetchErr := cl.AllRanges()
+	bw := bufio.NewWriter(w)
+	for _, name := range cl.activeProviderNames() {
+		ipRanges, ok := all[name]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(bw, "# %s\n", name)
+		for _, r := range hostsAsCIDRs(ipRanges) {
+			fmt.Fprintln(bw, r)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return fetchErr
+}
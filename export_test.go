@@ -0,0 +1,53 @@
+package cdn
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportCombined(t *testing.T) {
+	restoreConfig(t)
+	var ps []*staticProvider
+	for i := 0; i < 8; i++ {
+		p := newStaticProvider(fmt.Sprintf("p%d", i), fmt.Sprintf("10.%d.0.0/16", i), fmt.Sprintf("2001:db8:%x::1", i))
+		// Later providers finish first, so that completion order differs
+		// from name order.
+		p.delay = time.Duration(8-i) * 5 * time.Millisecond
+		ps = append(ps, p)
+	}
+	failing := newStaticProvider("failing")
+	failing.err = errors.New("unreachable")
+	withProviders(t, append(ps, failing)...)
+	SetMaxConcurrency(3)
+
+	var first string
+	for run := 0; run < 3; run++ {
+		// Start each run without cached ranges.
+		SetCacheDir(t.TempDir())
+		for _, p := range ps {
+			p.cache.evict()
+		}
+		var buf bytes.Buffer
+		err := ExportCombined(&buf)
+		if err == nil || !strings.Contains(err.Error(), "failing: unreachable") {
+			t.Errorf("ExportCombined error = %v; want the failing provider's error", err)
+		}
+		if run == 0 {
+			first = buf.String()
+		} else if buf.String() != first {
+			t.Fatalf("run %d output differs:\n%s\nfirst:\n%s", run, buf.String(), first)
+		}
+	}
+	if !strings.HasPrefix(first, "# p0\n10.0.0.0/16\n2001:db8::1/128\n# p1\n") || strings.Contains(first, "failing") {
+		t.Errorf("ExportCombined output:\n%s", first)
+	}
+
+	all, err := AllRanges()
+	if len(all) != 8 || err == nil {
+		t.Errorf("AllRanges = %d providers, %v", len(all), err)
+	}
+}
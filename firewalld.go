@@ -0,0 +1,85 @@
+package cdn
+
+import (
+	"encoding/xml"
+	"io"
+	"net"
+)
+
+// firewalldIPSet is a firewalld ipset definition, as stored in
+// /etc/firewalld/ipsets/<name>.xml.
+type firewalldIPSet struct {
+	XMLName     xml.Name          `xml:"ipset"`
+	Type        string            `xml:"type,attr"`
+	Short       string            `xml:"short"`
+	Description string            `xml:"description"`
+	Options     []firewalldOption `xml:"option"`
+	Entries     []string          `xml:"entry"`
+}
+
+type firewalldOption struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// ExportFirewalldIPSet writes a firewalld ipset of the IPv4 ranges of the
+// named provider of the default client; see Client.ExportFirewalldIPSet.
+func ExportFirewalldIPSet(providerName string, w io.Writer) error {
+	return defaultClient.ExportFirewalldIPSet(providerName, w)
+}
+
+// ExportFirewalldIPSet writes a firewalld ipset of type hash:net named
+// cdn-<providerName> to w, with an entry for each IPv4 range of the named
+// provider. An ipset holds addresses of one family only, so the IPv6 ranges
+// are written by ExportFirewalldIPSet6. firewalld expects each set in a file
+// named after it, e.g. /etc/firewalld/ipsets/cdn-cloudflare.xml.
+func (cl *Client) ExportFirewalldIPSet(providerName string, w io.Writer) error {
+	return cl.exportFirewalldIPSet(providerName, w, 4)
+}
+
+// ExportFirewalldIPSet6 writes a firewalld ipset of the IPv6 ranges of the
+// named provider of the default client; see Client.ExportFirewalldIPSet6.
+func ExportFirewalldIPSet6(providerName string, w io.Writer) error {
+	return defaultClient.ExportFirewalldIPSet6(providerName, w)
+}
+
+// ExportFirewalldIPSet6 is like ExportFirewalldIPSet for the IPv6 ranges,
+// in an ipset of family inet6 named cdn-<providerName>-v6.
+func (cl *Client) ExportFirewalldIPSet6(providerName string, w io.Writer) error {
+	return cl.exportFirewalldIPSet(providerName, w, 6)
+}
+
+func (cl *Client) exportFirewalldIPSet(providerName string, w io.Writer, version int) error {
+	ipRanges, err := cl.FetchIPRangesNormalized(providerName)
+	if err != nil {
+		return err
+	}
+	set := firewalldIPSet{
+		Type:        "hash:net",
+		Short:       "cdn-" + providerName,
+		Description: "IPv4 ranges of the " + providerName + " CDN",
+		Options:     []firewalldOption{{Name: "family", Value: "inet"}},
+	}
+	if version == 6 {
+		set.Short += "-v6"
+		set.Description = "IPv6 ranges of the " + providerName + " CDN"
+		set.Options[0].Value = "inet6"
+	}
+	for _, r := range ipRanges {
+		cidr := parseRange(r)
+		if cidr == nil || (len(cidr.IP) == net.IPv4len) != (version == 4) {
+			continue
+		}
+		set.Entries = append(set.Entries, r)
+	}
+	if _, err = io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err = enc.Encode(set); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,149 @@
+package cdn
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net"
+	"slices"
+	"testing"
+)
+
+func TestExportFirewalldIPSet(t *testing.T) {
+	withProviders(t, newStaticProvider("a", "192.0.2.0/24", "198.51.100.7", "2001:db8::/32"))
+	var buf bytes.Buffer
+	if err := ExportFirewalldIPSet("a", &buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<ipset type="hash:net">
+  <short>cdn-a</short>
+  <description>IPv4 ranges of the a CDN</description>
+  <option name="family" value="inet"></option>
+  <entry>192.0.2.0/24</entry>
+  <entry>198.51.100.7/32</entry>
+</ipset>
+`
+	if buf.String() != want {
+		t.Errorf("ipset:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	for _, tt := range []struct {
+		export  func(string, *bytes.Buffer) error
+		name    string
+		family  string
+		entries []string
+	}{
+		{func(p string, b *bytes.Buffer) error { return ExportFirewalldIPSet(p, b) }, "cdn-a", "inet", []string{"192.0.2.0/24", "198.51.100.7/32"}},
+		{func(p string, b *bytes.Buffer) error { return ExportFirewalldIPSet6(p, b) }, "cdn-a-v6", "inet6", []string{"2001:db8::/32"}},
+	} {
+		buf.Reset()
+		if err := tt.export("a", &buf); err != nil {
+			t.Fatal(err)
+		}
+		checkFirewalldIPSet(t, buf.Bytes(), tt.name, tt.family, tt.entries)
+	}
+}
+
+// firewalldIPSetChildren lists the elements allowed in an ipset, in the
+// order of the sequence in firewalld's ipset.xsd, with whether each may
+// repeat.
+var firewalldIPSetChildren = []struct {
+	name   string
+	repeat bool
+}{{"short", false}, {"description", false}, {"option", true}, {"entry", true}}
+
+// checkFirewalldIPSet checks data against the rules of firewalld's ipset
+// schema, here with entries of the set's family. The standard library has
+// no XSD validator, so this approximates the schema rather than validating
+// against it: it checks the root element and its attributes, the order and
+// count of the children, the attributes of options and that no element
+// nests others where the schema has strings.
+func checkFirewalldIPSet(t *testing.T, data []byte, name, family string, entries []string) {
+	t.Helper()
+	checkFirewalldStructure(t, data, name)
+	var set firewalldIPSet
+	if err := xml.Unmarshal(data, &set); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	if set.XMLName.Local != "ipset" || set.Type != "hash:net" || set.Short != name {
+		t.Errorf("%s: root = %s type=%q short=%q", name, set.XMLName.Local, set.Type, set.Short)
+	}
+	if len(set.Options) != 1 || set.Options[0] != (firewalldOption{Name: "family", Value: family}) {
+		t.Errorf("%s: options = %v", name, set.Options)
+	}
+	for _, entry := range set.Entries {
+		ip, _, err := net.ParseCIDR(entry)
+		if err != nil || (ip.To4() != nil) != (family == "inet") {
+			t.Errorf("%s: entry %q is not a %s network", name, entry, family)
+		}
+	}
+	if !slices.Equal(set.Entries, entries) {
+		t.Errorf("%s: entries = %v; want %v", name, set.Entries, entries)
+	}
+}
+
+// checkFirewalldStructure walks the elements of data and checks them
+// against firewalldIPSetChildren.
+func checkFirewalldStructure(t *testing.T, data []byte, name string) {
+	t.Helper()
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	depth, next, last := 0, 0, ""
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			depth++
+			switch depth {
+			case 1:
+				if tok.Name.Local != "ipset" || !hasAttrs(tok, []string{"type"}, "version") {
+					t.Errorf("%s: root %s with %v", name, tok.Name.Local, tok.Attr)
+				}
+				continue
+			case 2:
+			default:
+				t.Errorf("%s: %s nested in an ipset child", name, tok.Name.Local)
+				continue
+			}
+			child := tok.Name.Local
+			if child != last || !firewalldIPSetChildren[next-1].repeat {
+				for next < len(firewalldIPSetChildren) && firewalldIPSetChildren[next].name != child {
+					next++
+				}
+				if next == len(firewalldIPSetChildren) {
+					t.Fatalf("%s: unexpected or misplaced element %s", name, child)
+				}
+				next++
+			}
+			last = child
+			if child == "option" && !hasAttrs(tok, []string{"name"}, "value") {
+				t.Errorf("%s: option with %v", name, tok.Attr)
+			} else if child != "option" && len(tok.Attr) != 0 {
+				t.Errorf("%s: %s with attributes %v", name, child, tok.Attr)
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+// hasAttrs reports whether el has all the required attributes and no others
+// than those and the optional ones.
+func hasAttrs(el xml.StartElement, required []string, optional ...string) bool {
+	found := 0
+	for _, attr := range el.Attr {
+		switch {
+		case slices.Contains(required, attr.Name.Local):
+			found++
+		case !slices.Contains(optional, attr.Name.Local):
+			return false
+		}
+	}
+	return found == len(required)
+}
@@ -0,0 +1,28 @@
+package cdn
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// ExportHAProxy writes an HAProxy ACL file for providers of the default
+// client; see Client.ExportHAProxy.
+func ExportHAProxy(w io.Writer, providers ...string) error {
+	return defaultClient.ExportHAProxy(w, providers...)
+}
+
+// ExportHAProxy writes the ranges of the named providers, or of every
+// provider in use if none are named, one CIDR per line, for loading with
+// e.g. "acl from_cdn src -f /etc/haproxy/cdn.lst". IPv4 and IPv6 ranges are
+// listed together, merged into the fewest CIDRs and in canonical order,
+// after a comment header naming the providers and the time the file was
+// generated, then when the newest of the ranges was fetched, as ExportNginx
+// writes. Nothing is written if a provider fails.
+func (cl *Client) ExportHAProxy(w io.Writer, providers ...string) error {
+	return cl.exportMerged(w, providers, func(bw *bufio.Writer, cidrs []string) {
+		for _, cidr := range cidrs {
+			fmt.Fprintln(bw, cidr)
+		}
+	})
+}
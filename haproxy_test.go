@@ -0,0 +1,42 @@
+package cdn
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestExportHAProxy(t *testing.T) {
+	a := newStaticProvider("a", "192.0.2.0/25", "2001:db8::/32", "198.51.100.7", "192.0.2.0/25")
+	b := newStaticProvider("b", "192.0.2.128/25", "2001:db8:1::/48")
+	failing := newStaticProvider("failing")
+	failing.err = errors.New("unreachable")
+	withProviders(t, a, b, failing)
+	written := time.Now().Add(-time.Hour).Unix()
+	for _, p := range []*staticProvider{a, b} {
+		if err := p.cache.store(cacheData{Timestamp: written, IPRanges: p.ranges}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Now()
+	var buf bytes.Buffer
+	if err := ExportHAProxy(&buf, "b", "a"); err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf(`# Ranges as of %s.
+192.0.2.0/24
+198.51.100.7/32
+2001:db8::/32
+`, time.Unix(written, 0).UTC().Format(time.RFC3339))
+	if got := cutGeneratedHeader(t, buf.String(), "a, b", start); got != want {
+		t.Errorf("acl file:\n%s\nwant:\n%s", got, want)
+	}
+
+	buf.Reset()
+	if err := ExportHAProxy(&buf, "a", "failing"); err == nil || buf.Len() != 0 {
+		t.Errorf("failing provider: err = %v, wrote %q", err, buf.String())
+	}
+}
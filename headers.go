@@ -0,0 +1,62 @@
+package cdn
+
+import (
+	"net/http"
+	"strings"
+)
+
+// headerRule matches a response header: any value containing contains,
+// compared case-insensitively, or any value at all if contains is empty.
+type headerRule struct {
+	provider string
+	header   string
+	contains string
+}
+
+// headerRules are tried in order; the more specific headers come first, so
+// that e.g. CloudFront's X-Cache is not mistaken for another cache's.
+var headerRules = []headerRule{
+	{CloudFlare, "CF-Ray", ""},
+	{CloudFlare, "Server", "cloudflare"},
+	{CloudFront, "X-Amz-Cf-Id", ""},
+	{CloudFront, "X-Amz-Cf-Pop", ""},
+	{CloudFront, "X-Cache", "cloudfront"},
+	{CloudFront, "Via", "cloudfront"},
+	{Fastly, "X-Fastly-Request-Id", ""},
+	{Fastly, "Fastly-Debug-Digest", ""},
+	{Akamai, "Akamai-Grn", ""},
+	{Akamai, "X-Akamai-Transformed", ""},
+	{Akamai, "X-Akamai-Request-Id", ""},
+	{Akamai, "Server", "akamai"},
+	{Bunny, "CDN-PullZone", ""},
+	{Bunny, "Server", "bunnycdn"},
+	{Edgecast, "Server", "ecacc"},
+	{Edgecast, "Server", "ecs ("},
+	{Key, "Server", "keycdn"},
+	{Quic, "X-QC-Pop", ""},
+	{Myra, "Server", "myracloud"},
+	{Reblaze, "Server", "reblaze"},
+	{Section, "Section-Io-Id", ""},
+	{Google, "Server", "gws"},
+	{Google, "Server", "google frontend"},
+	{Google, "Via", "1.1 google"},
+	// Fastly names its caches cache-<airport><number> in X-Served-By, which
+	// other caches also set; it is the weakest hint, so it comes last.
+	{Fastly, "X-Served-By", "cache-"},
+}
+
+// DetectByHeaders guesses the CDN that served a response from its headers,
+// such as CF-Ray or X-Amz-Cf-Id, for CDNs whose ranges aren't published or
+// as a second opinion next to QueryName. It returns the provider name, e.g.
+// CloudFlare, or "" if no header gives it away. Headers can be forged and
+// proxies may pass on those of an upstream CDN, so the result is a hint.
+func DetectByHeaders(header http.Header) string {
+	for _, rule := range headerRules {
+		for _, value := range header.Values(rule.header) {
+			if strings.Contains(strings.ToLower(value), rule.contains) {
+				return rule.provider
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,31 @@
+package cdn
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDetectByHeaders(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		want   string
+	}{
+		{http.Header{"Server": {"cloudflare"}, "Cf-Ray": {"7d1b2c3d4e5f6a7b-AMS"}}, CloudFlare},
+		{http.Header{"X-Cache": {"Hit from cloudfront"}, "Via": {"1.1 0123abcd.cloudfront.net (CloudFront)"}}, CloudFront},
+		{http.Header{"X-Amz-Cf-Pop": {"FRA56-P1"}, "X-Served-By": {"cache-fra-1"}}, CloudFront},
+		{http.Header{"X-Served-By": {"cache-fra-eddf8230062-FRA"}, "X-Cache": {"HIT"}}, Fastly},
+		{http.Header{"X-Fastly-Request-Id": {"0f4a1c"}}, Fastly},
+		{http.Header{"Server": {"AkamaiGHost"}}, Akamai},
+		{http.Header{"Server": {"BunnyCDN-DE1-1054"}, "Cdn-Pullzone": {"12345"}}, Bunny},
+		{http.Header{"Server": {"ECAcc (dcb/7F3A)"}}, Edgecast},
+		{http.Header{"Server": {"keycdn-engine"}}, Key},
+		{http.Header{"Server": {"gws"}}, Google},
+		{http.Header{"Server": {"nginx"}, "X-Cache": {"MISS"}}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := DetectByHeaders(tt.header); got != tt.want {
+			t.Errorf("DetectByHeaders(%v) = %q; want %q", tt.header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package cdn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// HealthChecker is implemented by providers that check their upstream in
+// their own way. Other providers are checked with a request to their source.
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// healthCheck requests the provider's source URL, with the client's
+// User-Agent, limits and timeouts, and returns nil if it answers with a 2xx
+// status. The body isn't read, so neither the cache nor the parse statistics
+// are touched. A provider without a source URL is reported unhealthy.
+func (dp defaultProvider) healthCheck(ctx context.Context) error {
+	if dp.url == "" {
+		return &FetchError{Provider: dp.name, Err: errors.New("no source URL to check")}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, dp.url, nil)
+	if err != nil {
+		return &FetchError{Provider: dp.name, URL: dp.url, Err: err}
+	}
+	resp, err := dp.do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// HealthCheckAll runs the health checks of the default client's providers;
+// see Client.HealthCheckAll.
+func HealthCheckAll(ctx context.Context) map[string]error {
+	return defaultClient.HealthCheckAll(ctx)
+}
+
+// HealthCheckAll checks every provider in use in parallel and returns the
+// result of each, nil meaning healthy. Providers implementing HealthChecker
+// check themselves; the others are healthy if their source URL answers with a
+// 2xx status.
+func (cl *Client) HealthCheckAll(ctx context.Context) map[string]error {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]error)
+	)
+	sem := newSemaphore(cl.config().maxConcurrency)
+	for name, pro := range cl.activeProviders() {
+		var check func(context.Context) error
+		switch hc := pro.(type) {
+		case HealthChecker:
+			check = hc.HealthCheck
+		case interface{ healthCheck(context.Context) error }:
+			check = hc.healthCheck
+		default:
+			continue
+		}
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			sem.acquire()
+			defer sem.release()
+			err := check(ctx)
+			mu.Lock()
+			results[name] = err
+			mu.Unlock()
+		}(name)
+	}
+	wg.Wait()
+	return results
+}
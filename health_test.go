@@ -0,0 +1,100 @@
+package cdn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthCheckAll(t *testing.T) {
+	restoreConfig(t)
+	SetOptions(WithAllowInsecureHTTP(true))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/down":
+			http.Error(w, "maintenance", http.StatusServiceUnavailable)
+		case "/slow":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		default:
+			w.Write([]byte("192.0.2.0/24\n"))
+		}
+	}))
+	defer srv.Close()
+	up := newStaticProvider("up", "192.0.2.0/24")
+	up.url = srv.URL + "/up"
+	down := newStaticProvider("down", "192.0.2.0/24")
+	down.url = srv.URL + "/down"
+	nowhere := newStaticProvider("nowhere", "192.0.2.0/24")
+	nowhere.url = ""
+	withProviders(t, up, down, nowhere)
+
+	results := HealthCheckAll(context.Background())
+	if len(results) != 3 {
+		t.Fatalf("HealthCheckAll = %v; want 3 results", results)
+	}
+	if err := results["up"]; err != nil {
+		t.Errorf("up: %v", err)
+	}
+	var fe *FetchError
+	if err := results["down"]; !errors.As(err, &fe) || fe.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("down: %v; want a 503 FetchError", err)
+	}
+	if err := results["nowhere"]; err == nil {
+		t.Error("nowhere: provider without a source URL reported healthy")
+	}
+	if cached := CachedProviders(); len(cached) != 0 {
+		t.Errorf("health check wrote caches for %v", cached)
+	}
+	for _, p := range []*staticProvider{up, down, nowhere} {
+		if n := p.calls.Load(); n != 0 {
+			t.Errorf("%s: fetched %d times; want no fetch", p.name, n)
+		}
+		if s, err := GetProviderStats(p.name); err != nil || s.FetchCount != 0 || s.LastParse.Valid != 0 {
+			t.Errorf("%s: stats = %+v, %v; want none recorded", p.name, s, err)
+		}
+	}
+
+	slow := newStaticProvider("slow", "192.0.2.0/24")
+	slow.url = srv.URL + "/slow"
+	withProviders(t, slow)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := HealthCheckAll(ctx)["slow"]; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("slow: %v; want context.DeadlineExceeded", err)
+	}
+}
+
+func TestHealthCheckRequest(t *testing.T) {
+	restoreConfig(t)
+	var userAgent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.UserAgent()
+		w.Write([]byte("not a list\n"))
+	}))
+	defer srv.Close()
+	SetCacheDir(t.TempDir())
+	resetStats()
+	if err := Configure(Options{UserAgent: "health/1.0"}); err != nil {
+		t.Fatal(err)
+	}
+	p := newCloudFlare()
+	p.url = srv.URL + "/up"
+	if err := p.healthCheck(context.Background()); err != nil {
+		t.Errorf("up: %v", err)
+	}
+	if userAgent != "health/1.0" {
+		t.Errorf("User-Agent = %q; want the configured one", userAgent)
+	}
+	if _, err := p.cache.current(); err == nil {
+		t.Error("health check wrote the cache")
+	}
+	if s, _ := GetProviderStats(CloudFlare); s.LastParse.Valid != 0 || s.LastParse.Invalid != 0 {
+		t.Errorf("LastParse = %+v; want the body left unparsed", s.LastParse)
+	}
+}
@@ -0,0 +1,163 @@
+package cdn
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// HistoricalCacheBackend keeps every snapshot of each provider's ranges,
+// one JSON object per line in an append-only file per provider, so that
+// the ranges a provider used at a past date can be looked up, e.g. when
+// analysing old logs. A refresh that yields the ranges of the latest
+// snapshot adds none. Attach it to a client with WithHistoricalCache.
+type HistoricalCacheBackend struct {
+	dir string
+	mu  sync.Mutex
+	// latest holds the ranges of the newest snapshot of each provider
+	// appended or looked up so far.
+	latest map[string][]string
+}
+
+// NewHistoricalCacheBackend returns a backend storing its files in dir.
+func NewHistoricalCacheBackend(dir string) *HistoricalCacheBackend {
+	return &HistoricalCacheBackend{dir: dir}
+}
+
+func (h *HistoricalCacheBackend) filePath(providerName string) string {
+	return filepath.Join(h.dir, fmt.Sprintf(".%s.cdn.ip.history.jsonl", providerName))
+}
+
+// append adds cache as the newest snapshot of its provider, unless its
+// ranges are those of the newest snapshot already.
+func (h *HistoricalCacheBackend) append(providerName string, cache cacheData) error {
+	line, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if latest, ok := h.latestRanges(providerName); ok && slices.Equal(latest, cache.IPRanges) {
+		return nil
+	}
+	if err = os.MkdirAll(h.dir, 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(h.filePath(providerName), os.O_WRONLY|os.O_APPEND|os.O_CREATE, defaultCachePerm)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	if h.latest == nil {
+		h.latest = make(map[string][]string)
+	}
+	h.latest[providerName] = slices.Clone(cache.IPRanges)
+	return nil
+}
+
+// latestRanges returns the ranges of the newest snapshot of the named
+// provider and whether there is one, reading the file on first use. h.mu
+// must be held.
+func (h *HistoricalCacheBackend) latestRanges(providerName string) ([]string, bool) {
+	if ranges, ok := h.latest[providerName]; ok {
+		return ranges, true
+	}
+	file, err := os.ReadFile(h.filePath(providerName))
+	if err != nil {
+		return nil, false
+	}
+	lines := bytes.Split(bytes.TrimSpace(file), []byte("\n"))
+	for i := len(lines) - 1; i >= 0; i-- {
+		var cache cacheData
+		if json.Unmarshal(lines[i], &cache) == nil {
+			return cache.IPRanges, true
+		}
+	}
+	return nil, false
+}
+
+// snapshots returns the snapshots of the named provider in the order they
+// were written. A line that doesn't parse, such as one cut short by a
+// crash, is skipped.
+func (h *HistoricalCacheBackend) snapshots(providerName string) ([]cacheData, error) {
+	h.mu.Lock()
+	file, err := os.ReadFile(h.filePath(providerName))
+	h.mu.Unlock()
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: no history for %s", ErrCacheMiss, providerName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var result []cacheData
+	scanner := bufio.NewScanner(bytes.NewReader(file))
+	scanner.Buffer(nil, defaultMaxResponseSize)
+	for scanner.Scan() {
+		var cache cacheData
+		if err := json.Unmarshal(scanner.Bytes(), &cache); err != nil {
+			logger().Warn("skipping unreadable snapshot", "provider", providerName, "error", err)
+			continue
+		}
+		result = append(result, cache)
+	}
+	return result, scanner.Err()
+}
+
+// Read returns the most recent snapshot of the named provider.
+func (h *HistoricalCacheBackend) Read(providerName string) ([]string, error) {
+	return h.readUntil(providerName, math.MaxInt64)
+}
+
+// ReadAt returns the snapshot of the named provider that was current at t,
+// the newest one written at or before t. It fails with ErrCacheMiss if there
+// is none.
+func (h *HistoricalCacheBackend) ReadAt(providerName string, t time.Time) ([]string, error) {
+	return h.readUntil(providerName, t.Unix())
+}
+
+func (h *HistoricalCacheBackend) readUntil(providerName string, until int64) ([]string, error) {
+	snapshots, err := h.snapshots(providerName)
+	if err != nil {
+		return nil, err
+	}
+	var best *cacheData
+	for i, cache := range snapshots {
+		if cache.Timestamp <= until && (best == nil || cache.Timestamp >= best.Timestamp) {
+			best = &snapshots[i]
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("%w: no snapshot of %s before %s", ErrCacheMiss, providerName, time.Unix(until, 0))
+	}
+	return best.IPRanges, nil
+}
+
+// ListSnapshots returns when each snapshot of the named provider was
+// written, oldest first.
+func (h *HistoricalCacheBackend) ListSnapshots(providerName string) ([]time.Time, error) {
+	snapshots, err := h.snapshots(providerName)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]time.Time, 0, len(snapshots))
+	for _, cache := range snapshots {
+		result = append(result, time.Unix(cache.Timestamp, 0))
+	}
+	slices.SortFunc(result, func(a, b time.Time) int { return a.Compare(b) })
+	return result, nil
+}
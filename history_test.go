@@ -0,0 +1,69 @@
+package cdn
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestHistoricalCacheBackend(t *testing.T) {
+	restoreConfig(t)
+	h := NewHistoricalCacheBackend(t.TempDir())
+	p := newStaticProvider("hist")
+	withProviders(t, p)
+	SetOptions(WithHistoricalCache(h))
+
+	if _, err := h.Read("hist"); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("Read without history: err = %v; want ErrCacheMiss", err)
+	}
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	snapshots := [][]string{{"192.0.2.0/24"}, {"192.0.2.0/24", "198.51.100.0/24"}, {"203.0.113.0/24"}}
+	for i, ranges := range snapshots {
+		at := base.AddDate(0, i, 0).Unix()
+		if err := p.cache.store(cacheData{Provider: "hist", Timestamp: at, IPRanges: ranges}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	times, err := h.ListSnapshots("hist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(times) != 3 || !times[0].Equal(base) || !times[2].Equal(base.AddDate(0, 2, 0)) {
+		t.Errorf("ListSnapshots = %v", times)
+	}
+	if got, err := h.Read("hist"); err != nil || !slices.Equal(got, snapshots[2]) {
+		t.Errorf("Read = %v, %v; want %v", got, err, snapshots[2])
+	}
+	if got, err := h.ReadAt("hist", base.AddDate(0, 1, 15)); err != nil || !slices.Equal(got, snapshots[1]) {
+		t.Errorf("ReadAt mid-February = %v, %v; want %v", got, err, snapshots[1])
+	}
+	if _, err := h.ReadAt("hist", base.Add(-time.Hour)); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("ReadAt before the first snapshot: err = %v; want ErrCacheMiss", err)
+	}
+
+	// Refreshes yielding the latest ranges add no snapshot, also when the
+	// backend is new and has to find them in the file.
+	again := cacheData{Provider: "hist", Timestamp: base.AddDate(0, 3, 0).Unix(), IPRanges: snapshots[2]}
+	for _, backend := range []*HistoricalCacheBackend{h, NewHistoricalCacheBackend(h.dir)} {
+		if err := backend.append("hist", again); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if times, err := h.ListSnapshots("hist"); err != nil || len(times) != 3 {
+		t.Errorf("ListSnapshots after unchanged refreshes = %v, %v; want 3 snapshots", times, err)
+	}
+
+	// A line cut short by a crash doesn't hide the others.
+	file, err := os.OpenFile(h.filePath("hist"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"Timestamp": 17`)
+	file.Close()
+	if times, err := h.ListSnapshots("hist"); err != nil || len(times) != 3 {
+		t.Errorf("ListSnapshots with a torn line = %v, %v", times, err)
+	}
+}
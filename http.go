@@ -0,0 +1,158 @@
+package cdn
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+const (
+	defaultMaxResponseSize = 16 << 20
+	maxRedirects           = 5
+	// errorBodySnippet is how much of an error response is quoted in the
+	// error.
+	errorBodySnippet = 512
+)
+
+// ErrResponseTooLarge is returned when a provider endpoint sends more than
+// the allowed number of bytes.
+var ErrResponseTooLarge = errors.New("response body too large")
+
+// Each Client uses its own http.Client rather than http.DefaultClient so
+// that transport settings never leak into, or are affected by, the rest of
+// the program. Providers with their own proxy get a separate http.Client.
+func (cl *Client) httpClient(providerName string) *http.Client {
+	c := cl.config()
+	cl.httpMu.Lock()
+	defer cl.httpMu.Unlock()
+	if proxy, ok := c.providerProxies[providerName]; ok {
+		if cl.providerHTTP == nil {
+			cl.providerHTTP = make(map[string]*http.Client)
+		}
+		if cl.providerHTTP[providerName] == nil {
+			c.proxy = proxy
+			cl.providerHTTP[providerName] = newHTTPClient(c)
+		}
+		return cl.providerHTTP[providerName]
+	}
+	if cl.httpc == nil {
+		cl.httpc = newHTTPClient(c)
+	}
+	return cl.httpc
+}
+
+func (cl *Client) resetHTTPClient() {
+	cl.httpMu.Lock()
+	defer cl.httpMu.Unlock()
+	cl.httpc = nil
+	cl.providerHTTP = nil
+}
+
+func newHTTPClient(c config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if c.proxy != nil {
+		transport.Proxy = http.ProxyURL(c.proxy)
+	}
+	transport.TLSClientConfig = &tls.Config{
+		RootCAs:            c.rootCAs,
+		MinVersion:         c.minTLSVersion,
+		InsecureSkipVerify: c.insecureSkipVerify,
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   c.fetchTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			prev := via[len(via)-1].URL
+			if prev.Scheme == "https" && req.URL.Scheme != "https" && !c.allowInsecureHTTP {
+				return fmt.Errorf("refusing redirect from %s to insecure %s", prev, req.URL)
+			}
+			return nil
+		},
+	}
+}
+
+// validateSourceURL checks that rawURL is an absolute https URL, or http if
+// WithAllowInsecureHTTP is set.
+func (cl *Client) validateSourceURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Host == "" {
+		return fmt.Errorf("source URL %q has no host", rawURL)
+	}
+	switch {
+	case u.Scheme == "https":
+		return nil
+	case u.Scheme == "http" && cl.config().allowInsecureHTTP:
+		return nil
+	}
+	return fmt.Errorf("source URL %q must use https", rawURL)
+}
+
+// validateProviderSources checks the source and fallback URLs of p, if it
+// has any, with validateSourceURL. Object storage URLs, which
+// NewObjectStorageProvider checks, are left alone.
+func (cl *Client) validateProviderSources(p provider) error {
+	var urls []string
+	if s, ok := p.(interface{ sourceURL() string }); ok {
+		urls = append(urls, s.sourceURL())
+	}
+	if dp, ok := p.(interface{ fallbackSourceURL() string }); ok {
+		urls = append(urls, dp.fallbackSourceURL())
+	}
+	for _, rawURL := range urls {
+		if rawURL == "" {
+			continue
+		}
+		if u, err := url.Parse(rawURL); err == nil {
+			if _, ok := objectStorageTags[u.Scheme]; ok {
+				continue
+			}
+		}
+		if err := cl.validateSourceURL(rawURL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// limitedBody fails reads once more than limit bytes have been received,
+// instead of silently truncating like io.LimitReader.
+type limitedBody struct {
+	io.ReadCloser
+	url       string
+	limit     int64
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n, fmt.Errorf("%w: %s exceeded %d bytes", ErrResponseTooLarge, b.url, b.limit)
+	}
+	return n, err
+}
+
+// cancelOnClose releases the context of a request once its response body
+// is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
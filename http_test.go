@@ -0,0 +1,260 @@
+package cdn
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithRootCAs(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "173.245.48.0/20")
+	}))
+	defer srv.Close()
+	p := newCloudFlare()
+	p.url = srv.URL
+
+	if _, err := p.FetchIPRanges(); err == nil {
+		t.Fatal("fetch from untrusted server succeeded")
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	SetOptions(WithRootCAs(pool))
+	defer SetOptions(WithRootCAs(nil))
+	ipRanges, err := p.FetchIPRanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ipRanges) != 1 || ipRanges[0] != "173.245.48.0/20" {
+		t.Errorf("FetchIPRanges = %v", ipRanges)
+	}
+}
+
+func TestMaxResponseSize(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/json" {
+			fmt.Fprint(w, `{"addresses":[`)
+			for i := 0; i < 1000; i++ {
+				fmt.Fprintf(w, `"10.0.%d.0/24",`, i%256)
+			}
+			fmt.Fprint(w, `"10.1.0.0/24"]}`)
+			return
+		}
+		for i := 0; i < 1000; i++ {
+			fmt.Fprintf(w, "10.0.%d.0/24\n", i%256)
+		}
+	}))
+	defer srv.Close()
+	SetOptions(WithMaxResponseSize(1024))
+	defer SetOptions(WithMaxResponseSize(0))
+
+	p := newCloudFlare()
+	p.url = srv.URL
+	if _, err := p.FetchIPRanges(); !errors.Is(err, ErrResponseTooLarge) {
+		t.Errorf("plain text provider: err = %v; want ErrResponseTooLarge", err)
+	}
+	f := newFastly()
+	f.url = srv.URL + "/json"
+	if _, err := f.FetchIPRanges(); !errors.Is(err, ErrResponseTooLarge) {
+		t.Errorf("JSON provider: err = %v; want ErrResponseTooLarge", err)
+	}
+}
+
+func TestRedirectDowngradeRefused(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "173.245.48.0/20")
+	}))
+	defer plain.Close()
+	secure := httptest.NewTLSServer(http.RedirectHandler(plain.URL, http.StatusFound))
+	defer secure.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(secure.Certificate())
+	SetOptions(WithRootCAs(pool))
+	defer SetOptions(WithRootCAs(nil), WithAllowInsecureHTTP(false))
+
+	p := newCloudFlare()
+	p.url = secure.URL
+	if _, err := p.FetchIPRanges(); err == nil || !strings.Contains(err.Error(), "insecure") {
+		t.Errorf("err = %v; want refused downgrade", err)
+	}
+	SetOptions(WithAllowInsecureHTTP(true))
+	if _, err := p.FetchIPRanges(); err != nil {
+		t.Errorf("with WithAllowInsecureHTTP: %v", err)
+	}
+}
+
+func TestSetProviderURL(t *testing.T) {
+	p := newCloudFlare()
+	defaultProviders()["test-url"] = p
+	defer delete(Providers, "test-url")
+	defer SetOptions(WithAllowInsecureHTTP(false))
+
+	if err := SetProviderURL("test-url", "http://mirror.internal/ips-v4"); err == nil {
+		t.Error("plain http URL accepted")
+	}
+	if err := SetProviderURL("test-url", "https://mirror.internal/ips-v4"); err != nil || p.url != "https://mirror.internal/ips-v4" {
+		t.Errorf("https URL: err = %v, url = %s", err, p.url)
+	}
+	SetOptions(WithAllowInsecureHTTP(true))
+	if err := SetProviderURL("test-url", "http://mirror.internal/ips-v4"); err != nil {
+		t.Errorf("http URL with WithAllowInsecureHTTP: %v", err)
+	}
+	if err := SetProviderURL("missing", "https://mirror.internal/"); err == nil {
+		t.Error("unknown provider accepted")
+	}
+}
+
+func TestSetProviderFallbackURL(t *testing.T) {
+	restoreConfig(t)
+	SetOptions(WithAllowInsecureHTTP(true))
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "maintenance", http.StatusInternalServerError)
+	}))
+	defer primary.Close()
+	p := newCloudFlare()
+	p.url = primary.URL
+	defaultProviders()["test-fallback"] = p
+	defer delete(Providers, "test-fallback")
+
+	if _, err := p.FetchIPRanges(); err == nil {
+		t.Fatal("failing primary accepted without a fallback")
+	}
+	if err := SetProviderFallbackURL("test-fallback", serveText(t, "192.0.2.0/24\n")); err != nil {
+		t.Fatal(err)
+	}
+	if ipRanges, err := p.FetchIPRanges(); err != nil || !slices.Equal(ipRanges, []string{"192.0.2.0/24"}) {
+		t.Errorf("FetchIPRanges = %v, %v; want the secondary's ranges", ipRanges, err)
+	}
+
+	if err := SetProviderFallbackURL("test-fallback", primary.URL+"/mirror"); err != nil {
+		t.Fatal(err)
+	}
+	var fetchErr *FetchError
+	if _, err := p.FetchIPRanges(); !errors.As(err, &fetchErr) || fetchErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("both sources failing: err = %v; want a FetchError", err)
+	}
+}
+
+func TestBuiltinProviderURLsUseHTTPS(t *testing.T) {
+	for name, pro := range defaultProviders() {
+		p, ok := pro.(interface{ sourceURL() string })
+		if !ok || p.sourceURL() == "" {
+			continue
+		}
+		if err := defaultClient.validateSourceURL(p.sourceURL()); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestErrorStatusNotCached(t *testing.T) {
+	restoreConfig(t)
+	SetCacheDir(t.TempDir())
+	SetValidationHook(nil)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/forbidden", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "<html>Access denied</html>", http.StatusForbidden)
+	})
+	mux.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upstream timed out", http.StatusInternalServerError)
+	})
+	mux.Handle("/moved", http.RedirectHandler("/forbidden", http.StatusFound))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	for path, want := range map[string]string{
+		"/forbidden": "403 Forbidden",
+		"/error":     "upstream timed out",
+		"/moved":     "Access denied",
+	} {
+		p := newCloudFlare()
+		p.url = srv.URL + path
+		_, err := p.FetchIPRangesWithCache(context.Background())
+		if err == nil {
+			t.Errorf("%s: error status accepted", path)
+			continue
+		}
+		for _, s := range []string{CloudFlare, srv.URL, want} {
+			if !strings.Contains(err.Error(), s) {
+				t.Errorf("%s: error %q does not mention %q", path, err, s)
+			}
+		}
+	}
+	if cached := CachedProviders(); len(cached) != 0 {
+		t.Errorf("error responses were cached for %v", cached)
+	}
+}
+
+func TestWithProviderProxy(t *testing.T) {
+	restoreConfig(t)
+	proxy := func(ranges string, hits *atomic.Int32) *url.URL {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			fmt.Fprintln(w, ranges)
+		}))
+		t.Cleanup(srv.Close)
+		u, _ := url.Parse(srv.URL)
+		return u
+	}
+	var generalHits, webHits atomic.Int32
+	general := proxy("192.0.2.0/24", &generalHits)
+	web := proxy("198.51.100.0/24", &webHits)
+	if err := Configure(Options{HTTPProxy: general.String()}); err != nil {
+		t.Fatal(err)
+	}
+	SetOptions(WithProviderProxy(Akamai, web))
+
+	direct, proxied := newCloudFlare(), newCloudFlare()
+	direct.url = "http://ranges.example/cloudflare"
+	proxied.name, proxied.url = Akamai, "http://ranges.example/akamai"
+	if ranges, err := direct.FetchIPRanges(); err != nil || fmt.Sprint(ranges) != "[192.0.2.0/24]" {
+		t.Errorf("general proxy: %v, %v", ranges, err)
+	}
+	if ranges, err := proxied.FetchIPRanges(); err != nil || fmt.Sprint(ranges) != "[198.51.100.0/24]" {
+		t.Errorf("provider proxy: %v, %v", ranges, err)
+	}
+	if generalHits.Load() != 1 || webHits.Load() != 1 {
+		t.Errorf("general proxy saw %d requests, provider proxy %d; want 1 each", generalHits.Load(), webHits.Load())
+	}
+
+	SetOptions(WithProviderProxy(Akamai, nil))
+	if _, err := proxied.FetchIPRanges(); err != nil || generalHits.Load() != 2 {
+		t.Errorf("override not removed: err = %v, general proxy hits = %d", err, generalHits.Load())
+	}
+}
+
+func TestWithRequestTimeout(t *testing.T) {
+	restoreConfig(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(300 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+		fmt.Fprintln(w, "192.0.2.0/24")
+	}))
+	defer srv.Close()
+	SetOptions(WithRequestTimeout(CloudFlare, 50*time.Millisecond))
+
+	limited, other := newCloudFlare(), newCloudFlare()
+	limited.url = srv.URL
+	other.name, other.url = Bunny, srv.URL
+	if _, err := limited.FetchIPRanges(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v; want a timeout", err)
+	}
+	if _, err := other.FetchIPRanges(); err != nil {
+		t.Errorf("provider without timeout: %v", err)
+	}
+	if info, err := GetProviderInfo(CloudFlare); err != nil || info.RequestTimeout != 50*time.Millisecond {
+		t.Errorf("GetProviderInfo = %+v, %v", info, err)
+	}
+}
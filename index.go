@@ -0,0 +1,334 @@
+package cdn
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"net"
+	"slices"
+)
+
+// rangeIndex is the parsed form of a provider's ranges, split by address
+// family and indexed in a trie per family for lookups.
+type rangeIndex struct {
+	source       []string
+	v4           []*net.IPNet
+	v6           []*net.IPNet
+	trie4, trie6 cidrTrie
+	// invalid counts the entries of source that didn't parse.
+	invalid int
+}
+
+func newRangeIndex(name string, ipRanges []string) *rangeIndex {
+	idx := &rangeIndex{source: ipRanges}
+	for _, rangeOrIP := range ipRanges {
+		cidr := parseRange(rangeOrIP)
+		if cidr == nil {
+			logger().Warn("unparseable ip range", "provider", name, "line", rangeOrIP)
+			idx.invalid++
+			continue
+		}
+		if len(cidr.IP) == net.IPv4len {
+			idx.v4 = append(idx.v4, cidr)
+			idx.trie4.insert(cidr)
+		} else {
+			idx.v6 = append(idx.v6, cidr)
+			idx.trie6.insert(cidr)
+		}
+	}
+	return idx
+}
+
+// parseRange parses a CIDR or a bare address, as a host range, or returns
+// nil. IPv4 ranges, including IPv4-mapped ones such as
+// ::ffff:192.0.2.0/120, come back with a 4-byte IP and mask.
+func parseRange(rangeOrIP string) *net.IPNet {
+	_, cidr, err := net.ParseCIDR(rangeOrIP)
+	if err != nil {
+		ip := net.ParseIP(rangeOrIP)
+		if ip == nil {
+			return nil
+		}
+		return hostNet(ip)
+	}
+	if ip4 := cidr.IP.To4(); ip4 != nil && len(cidr.IP) == net.IPv6len {
+		cidr = &net.IPNet{IP: ip4, Mask: cidr.Mask[12:]}
+	}
+	return cidr
+}
+
+// hasValidRange reports whether any entry of ipRanges parses as a range.
+func hasValidRange(ipRanges []string) bool {
+	for _, r := range ipRanges {
+		if parseRange(r) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// compareNets orders ranges parsed by parseRange by address family, IPv4
+// first, then by network address and then by prefix length.
+func compareNets(a, b *net.IPNet) int {
+	if c := cmp.Compare(len(a.IP), len(b.IP)); c != 0 {
+		return c
+	}
+	if c := bytes.Compare(a.IP, b.IP); c != 0 {
+		return c
+	}
+	return cmp.Compare(prefixLen(a), prefixLen(b))
+}
+
+// subtractRanges returns the parts of ipRanges not covered by any range of
+// remove, splitting partly covered ranges into smaller CIDRs. Entries that
+// don't parse are dropped.
+func subtractRanges(ipRanges, remove []string) []string {
+	var removeNets []*net.IPNet
+	for _, r := range remove {
+		if cidr := parseRange(r); cidr != nil {
+			removeNets = append(removeNets, cidr)
+		}
+	}
+	var result []string
+	for _, r := range ipRanges {
+		cidr := parseRange(r)
+		if cidr == nil {
+			continue
+		}
+		for _, part := range subtractNet(cidr, removeNets) {
+			result = append(result, part.String())
+		}
+	}
+	return result
+}
+
+// mergeRanges returns ipRanges as the fewest CIDRs covering the same
+// addresses, in compareNets order: ranges within others are dropped and
+// adjacent halves of a larger range are joined. Entries that don't parse
+// are dropped.
+func mergeRanges(ipRanges []string) []string {
+	var nets []*net.IPNet
+	for _, r := range ipRanges {
+		if cidr := parseRange(r); cidr != nil {
+			nets = append(nets, cidr)
+		}
+	}
+	slices.SortFunc(nets, compareNets)
+	var merged []*net.IPNet
+	for _, cidr := range nets {
+		if n := len(merged); n > 0 && len(merged[n-1].IP) == len(cidr.IP) && merged[n-1].Contains(cidr.IP) {
+			continue
+		}
+		merged = append(merged, cidr)
+		for n := len(merged); n >= 2; n = len(merged) {
+			parent := joinSiblings(merged[n-2], merged[n-1])
+			if parent == nil {
+				break
+			}
+			merged = append(merged[:n-2], parent)
+		}
+	}
+	result := make([]string, len(merged))
+	for i, cidr := range merged {
+		result[i] = cidr.String()
+	}
+	return result
+}
+
+// joinSiblings returns the range whose halves are a and b, in that order,
+// or nil if there is none.
+func joinSiblings(a, b *net.IPNet) *net.IPNet {
+	ones, bits := a.Mask.Size()
+	if len(a.IP) != len(b.IP) || ones == 0 || prefixLen(b) != ones {
+		return nil
+	}
+	mask := net.CIDRMask(ones-1, bits)
+	parent := &net.IPNet{IP: a.IP.Mask(mask), Mask: mask}
+	if !parent.IP.Equal(a.IP) || !parent.Contains(b.IP) || a.Contains(b.IP) {
+		return nil
+	}
+	return parent
+}
+
+func subtractNet(cidr *net.IPNet, remove []*net.IPNet) []*net.IPNet {
+	var inside []*net.IPNet
+	for _, r := range remove {
+		if len(r.IP) != len(cidr.IP) {
+			continue
+		}
+		if r.Contains(cidr.IP) && prefixLen(r) <= prefixLen(cidr) {
+			return nil
+		}
+		if cidr.Contains(r.IP) {
+			inside = append(inside, r)
+		}
+	}
+	if len(inside) == 0 {
+		return []*net.IPNet{cidr}
+	}
+	ones, bits := cidr.Mask.Size()
+	mask := net.CIDRMask(ones+1, bits)
+	upper := slices.Clone(cidr.IP)
+	upper[ones/8] |= 0x80 >> (ones % 8)
+	return append(
+		subtractNet(&net.IPNet{IP: cidr.IP, Mask: mask}, inside),
+		subtractNet(&net.IPNet{IP: upper, Mask: mask}, inside)...)
+}
+
+func hostNet(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// family returns the ranges that can contain ip, or none if version (4 or
+// 6) excludes its address family.
+func (idx *rangeIndex) family(ip net.IP, version int) []*net.IPNet {
+	if ip.To4() != nil {
+		if version == 6 {
+			return nil
+		}
+		return idx.v4
+	}
+	if version == 4 {
+		return nil
+	}
+	return idx.v6
+}
+
+func (idx *rangeIndex) match(name string, ip net.IP, c config) bool {
+	return idx.lookup(name, ip, c) != nil
+}
+
+// lookup returns the most specific range containing ip, or nil.
+func (idx *rangeIndex) lookup(name string, ip net.IP, c config) *net.IPNet {
+	if c.debug {
+		return idx.scan(name, ip, c.ipVersion)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		if c.ipVersion == 6 {
+			return nil
+		}
+		return idx.trie4.lookup(ip4)
+	}
+	if c.ipVersion == 4 || len(ip) != net.IPv6len {
+		return nil
+	}
+	return idx.trie6.lookup(ip)
+}
+
+// scan is lookup by comparing ip with every range of its family, so that
+// debug mode can log each comparison.
+func (idx *rangeIndex) scan(name string, ip net.IP, version int) *net.IPNet {
+	var best *net.IPNet
+	for _, cidr := range idx.family(ip, version) {
+		matched := cidr.Contains(ip)
+		logger().Debug("cidr comparison", "provider", name, "cidr", cidr.String(), "ip", ip.String(), "matched", matched)
+		if matched && (best == nil || prefixLen(cidr) > prefixLen(best)) {
+			best = cidr
+		}
+	}
+	return best
+}
+
+func prefixLen(cidr *net.IPNet) int {
+	ones, _ := cidr.Mask.Size()
+	return ones
+}
+
+type indexer interface {
+	index(ipRanges []string) *rangeIndex
+}
+
+// index returns the parsed form of ipRanges, reusing the previous one while
+// the cache hands out the same ranges. The slices are compared by identity
+// rather than content, so that a lookup costs no more than the trie walk:
+// the cache never modifies a slice it has handed out, and replaces it on
+// every store.
+func (dp defaultProvider) index(ipRanges []string) *rangeIndex {
+	dp.cache.mu.Lock()
+	defer dp.cache.mu.Unlock()
+	if dp.cache.index == nil || !sameSlice(dp.cache.index.source, ipRanges) {
+		dp.cache.index = newRangeIndex(dp.name, ipRanges)
+	}
+	return dp.cache.index
+}
+
+// sameSlice reports whether a and b share their elements, not merely
+// whether they are equal.
+func sameSlice(a, b []string) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+func indexOf(name string, pro provider, ipRanges []string) *rangeIndex {
+	if ix, ok := pro.(indexer); ok {
+		return ix.index(ipRanges)
+	}
+	return newRangeIndex(name, ipRanges)
+}
+
+func (cl *Client) matchRanges(name string, pro provider, ipRanges []string, ip net.IP) bool {
+	return indexOf(name, pro, ipRanges).match(name, ip, cl.config())
+}
+
+func (cl *Client) lookupRanges(name string, pro provider, ipRanges []string, ip net.IP) *net.IPNet {
+	c := cl.config()
+	idx := indexOf(name, pro, ipRanges)
+	if c.logParseFailures && idx.invalid > 0 {
+		logger().Warn("lookup skipped unparseable ranges", "provider", name, "invalid", idx.invalid, "valid", len(idx.v4)+len(idx.v6))
+	}
+	return idx.lookup(name, ip, c)
+}
+
+// FetchIPNets returns the parsed ranges of the named provider of the
+// default client; see Client.FetchIPNets.
+func FetchIPNets(providerName string) ([]*net.IPNet, error) {
+	return defaultClient.FetchIPNets(providerName)
+}
+
+// FetchIPNets returns the parsed ranges of the named provider, IPv4 first,
+// fetching them through the cache. Entries that don't parse are skipped. The
+// lookup index QueryName uses is built from the same ranges, so calling
+// FetchIPNets ahead of time spares the first query that work.
+func (cl *Client) FetchIPNets(providerName string) ([]*net.IPNet, error) {
+	pro, err := cl.GetProvider(providerName)
+	if err != nil {
+		return nil, err
+	}
+	ipRanges, err := pro.FetchIPRangesWithCache(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	idx := indexOf(providerName, pro, ipRanges)
+	return append(slices.Clone(idx.v4), idx.v6...), nil
+}
+
+// CIDROverlapsAny reports whether cidr shares at least one address with any
+// range of the named provider of the default client.
+func CIDROverlapsAny(cidr string, providerName string) (bool, error) {
+	return defaultClient.CIDROverlapsAny(cidr, providerName)
+}
+
+// CIDROverlapsAny reports whether cidr shares at least one address with any
+// range of the named provider.
+func (cl *Client) CIDROverlapsAny(cidr string, providerName string) (bool, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false, err
+	}
+	pro, err := cl.GetProvider(providerName)
+	if err != nil {
+		return false, err
+	}
+	ipRanges, err := pro.FetchIPRangesWithCache(context.Background())
+	if err != nil {
+		return false, err
+	}
+	for _, r := range indexOf(providerName, pro, ipRanges).family(network.IP, cl.config().ipVersion) {
+		if r.Contains(network.IP) || network.Contains(r.IP) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
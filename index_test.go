@@ -0,0 +1,210 @@
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mixedRanges(n int) []string {
+	var ipRanges []string
+	for i := 0; i < n; i++ {
+		ipRanges = append(ipRanges,
+			fmt.Sprintf("10.%d.%d.0/24", i/256, i%256),
+			fmt.Sprintf("2001:db8:%x::/48", i),
+		)
+	}
+	return ipRanges
+}
+
+func TestRangeIndexFamilies(t *testing.T) {
+	idx := newRangeIndex("test", []string{"192.0.2.0/24", "2001:db8::/32", "198.51.100.7", "2001:db8:ffff::1", "junk"})
+	if len(idx.v4) != 2 || len(idx.v6) != 2 {
+		t.Fatalf("v4 = %v, v6 = %v", idx.v4, idx.v6)
+	}
+	for ip, want := range map[string]bool{
+		"192.0.2.1":        true,
+		"198.51.100.7":     true,
+		"198.51.100.8":     false,
+		"2001:db8::1":      true,
+		"::ffff:192.0.2.1": true,
+		"2001:db9::1":      false,
+	} {
+		if got := idx.match("test", net.ParseIP(ip), config{}); got != want {
+			t.Errorf("match(%s) = %v; want %v", ip, got, want)
+		}
+	}
+}
+
+// BenchmarkMatch compares scanning every prefix with scanning only the
+// prefixes of the address's family, where comparisons/op shows the saving,
+// and with the trie lookup QueryName uses, alone and through a provider's
+// cache as QueryName calls it.
+func BenchmarkMatch(b *testing.B) {
+	idx := newRangeIndex("bench", mixedRanges(500))
+	all := append(append([]*net.IPNet{}, idx.v4...), idx.v6...)
+	ip := net.ParseIP("192.0.2.1")
+
+	b.Run("all", func(b *testing.B) {
+		comparisons := 0
+		for i := 0; i < b.N; i++ {
+			for _, cidr := range all {
+				comparisons++
+				if cidr.Contains(ip) {
+					break
+				}
+			}
+		}
+		b.ReportMetric(float64(comparisons)/float64(b.N), "comparisons/op")
+	})
+	b.Run("family", func(b *testing.B) {
+		comparisons := 0
+		for i := 0; i < b.N; i++ {
+			for _, cidr := range idx.family(ip, 0) {
+				comparisons++
+				if cidr.Contains(ip) {
+					break
+				}
+			}
+		}
+		b.ReportMetric(float64(comparisons)/float64(b.N), "comparisons/op")
+	})
+	b.Run("trie", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			idx.lookup("bench", ip, config{})
+		}
+	})
+	b.Run("provider", func(b *testing.B) {
+		p := newStaticProvider("bench")
+		p.cache.mem = &cacheData{Timestamp: time.Now().Unix(), IPRanges: mixedRanges(500)}
+		for i := 0; i < b.N; i++ {
+			ipRanges, _ := p.cache.read()
+			indexOf("bench", p, ipRanges).lookup("bench", ip, config{})
+		}
+	})
+}
+
+func TestIndexReuse(t *testing.T) {
+	p := newStaticProvider("test", "192.0.2.0/24")
+	withProviders(t, p)
+	first, err := p.FetchIPRangesWithCache(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := indexOf("test", p, first)
+	again, _ := p.FetchIPRangesWithCache(context.Background())
+	if indexOf("test", p, again) != idx {
+		t.Error("index rebuilt for the same cached ranges")
+	}
+	if err := p.cache.write([]string{"198.51.100.0/24"}, ""); err != nil {
+		t.Fatal(err)
+	}
+	updated, _ := p.FetchIPRangesWithCache(context.Background())
+	if got := indexOf("test", p, updated); got == idx || !got.match("test", net.ParseIP("198.51.100.1"), config{}) {
+		t.Error("index not rebuilt after the cache was updated")
+	}
+	if indexOf("test", p, slices.Clone(updated)) == idx {
+		t.Error("index of other ranges reused")
+	}
+}
+
+func TestCIDROverlapsAny(t *testing.T) {
+	withProviders(t, newStaticProvider("test", "192.0.2.0/24", "198.51.100.7", "2001:db8::/32"))
+	tests := []struct {
+		cidr string
+		want bool
+	}{
+		{"192.0.2.128/25", true},
+		{"192.0.0.0/16", true},
+		{"198.51.100.0/24", true},
+		{"198.51.101.0/24", false},
+		{"2001:db8:1::/48", true},
+		{"2001:db9::/32", false},
+	}
+	for _, tt := range tests {
+		got, err := CIDROverlapsAny(tt.cidr, "test")
+		if err != nil || got != tt.want {
+			t.Errorf("CIDROverlapsAny(%s) = %v, %v; want %v", tt.cidr, got, err, tt.want)
+		}
+	}
+	if _, err := CIDROverlapsAny("192.0.2.0", "test"); err == nil {
+		t.Error("bare address accepted as CIDR")
+	}
+	if _, err := CIDROverlapsAny("192.0.2.0/24", "missing"); err == nil {
+		t.Error("unknown provider accepted")
+	}
+}
+
+func TestFetchIPNets(t *testing.T) {
+	withProviders(t, newStaticProvider("test", "2001:db8::/32", "192.0.2.0/24", "198.51.100.7"))
+	nets, err := FetchIPNets("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, n := range nets {
+		got = append(got, n.String())
+	}
+	if want := []string{"192.0.2.0/24", "198.51.100.7/32", "2001:db8::/32"}; !slices.Equal(got, want) {
+		t.Errorf("FetchIPNets = %v; want %v", got, want)
+	}
+	if _, err := FetchIPNets("missing"); !errors.Is(err, ErrProviderNotFound) {
+		t.Errorf("unknown provider: err = %v", err)
+	}
+}
+
+func TestSubtractRanges(t *testing.T) {
+	got := subtractRanges(
+		[]string{"10.0.0.0/8", "192.0.2.0/24", "198.51.100.0/24", "2001:db8::/32"},
+		[]string{"10.0.0.0/9", "10.192.0.0/10", "198.51.100.0/23", "2001:db8:8000::/33"},
+	)
+	want := []string{"10.128.0.0/10", "192.0.2.0/24", "2001:db8::/33"}
+	if !slices.Equal(got, want) {
+		t.Errorf("subtractRanges = %v; want %v", got, want)
+	}
+}
+
+func TestMergeRanges(t *testing.T) {
+	got := mergeRanges([]string{
+		"192.0.2.128/25", "192.0.2.0/25", "192.0.2.7", "198.51.100.0/24", "198.51.101.0/24",
+		"198.51.102.0/24", "10.0.0.0/8", "10.1.0.0/16", "2001:db8::/33", "2001:db8:8000::/33",
+		"203.0.113.1", "203.0.113.2", "203.0.113.3", "junk",
+	})
+	want := []string{
+		"10.0.0.0/8", "192.0.2.0/24", "198.51.100.0/23", "198.51.102.0/24",
+		"203.0.113.1/32", "203.0.113.2/31", "2001:db8::/32",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("mergeRanges = %v; want %v", got, want)
+	}
+}
+
+func TestParseFailureLogging(t *testing.T) {
+	restoreConfig(t)
+	var buf bytes.Buffer
+	SetLogger(slog.New(slog.NewTextHandler(&buf, nil)))
+	defer SetLogger(nil)
+	SetValidationHook(nil)
+	withProviders(t, newStaticProvider("drifting", "192.0.2.0/24", "192.0.2.0/33", "198.51.100.0/24", "cidr,region"))
+	SetOptions(WithBogonFilter(false))
+
+	QueryName(net.ParseIP("198.51.100.1"))
+	if strings.Contains(buf.String(), "lookup skipped unparseable ranges") {
+		t.Errorf("failures reported without the option:\n%s", buf.String())
+	}
+	SetOptions(WithParseFailureLogging(true))
+	buf.Reset()
+	if name := QueryName(net.ParseIP("198.51.100.1")); name != "drifting" {
+		t.Errorf("QueryName = %q; want drifting", name)
+	}
+	if want := `msg="lookup skipped unparseable ranges" provider=drifting invalid=2 valid=2`; !strings.Contains(buf.String(), want) {
+		t.Errorf("log lacks %q:\n%s", want, buf.String())
+	}
+}
@@ -0,0 +1,103 @@
+package cdn
+
+import (
+	"slices"
+	"time"
+)
+
+// ProviderInfo describes how a provider is fetched.
+type ProviderInfo struct {
+	Name string
+	// SourceURL is where the ranges are fetched from, empty for providers
+	// backed by embedded data.
+	SourceURL string
+	// RequestTimeout is the timeout set with WithRequestTimeout, zero if
+	// only the general FetchTimeout applies.
+	RequestTimeout time.Duration
+}
+
+// GetProviderInfo describes the named provider of the default client.
+func GetProviderInfo(name string) (ProviderInfo, error) {
+	return defaultClient.GetProviderInfo(name)
+}
+
+// GetProviderInfo describes the named provider.
+func (cl *Client) GetProviderInfo(name string) (ProviderInfo, error) {
+	pro, err := cl.GetProvider(name)
+	if err != nil {
+		return ProviderInfo{}, err
+	}
+	info := ProviderInfo{Name: name, RequestTimeout: cl.config().requestTimeouts[name]}
+	if p, ok := pro.(interface{ sourceURL() string }); ok {
+		info.SourceURL = p.sourceURL()
+	}
+	return info, nil
+}
+
+// ProviderMeta describes where a provider's ranges come from and what to
+// expect of them, for choosing which providers to use.
+type ProviderMeta struct {
+	Name string
+	// SourceURL is where the ranges are fetched from, as in ProviderInfo.
+	SourceURL string
+	// DocsURL is the provider's documentation of its ranges, if any.
+	DocsURL string
+	// UpdateFrequencyHint is roughly how often the ranges change: "daily",
+	// "weekly", "irregular" or "never", or empty if unknown.
+	UpdateFrequencyHint string
+	// SupportedIPVersions lists the address families, 4 and 6, the
+	// provider's ranges cover.
+	SupportedIPVersions []int
+}
+
+// builtinMeta holds the parts of the built-in providers' ProviderMeta that
+// aren't part of the provider itself.
+var builtinMeta = map[string]ProviderMeta{
+	Akamai:             {DocsURL: "https://techdocs.akamai.com/origin-ip-acl/docs/welcome", UpdateFrequencyHint: "irregular", SupportedIPVersions: []int{4, 6}},
+	Bunny:              {DocsURL: "https://docs.bunny.net/docs/cdn-edge-server-ip-list", UpdateFrequencyHint: "daily", SupportedIPVersions: []int{4}},
+	CacheFly:           {UpdateFrequencyHint: "irregular", SupportedIPVersions: []int{4}},
+	CloudFlare:         {DocsURL: "https://www.cloudflare.com/ips/", UpdateFrequencyHint: "irregular", SupportedIPVersions: []int{4}},
+	CloudFlareAccess:   {DocsURL: "https://developers.cloudflare.com/cloudflare-one/policies/access/", UpdateFrequencyHint: "irregular", SupportedIPVersions: []int{4, 6}},
+	CloudFlareWarp:     {DocsURL: "https://developers.cloudflare.com/cloudflare-one/connections/connect-devices/warp/deployment/firewall/", UpdateFrequencyHint: "irregular", SupportedIPVersions: []int{4, 6}},
+	CloudFront:         {DocsURL: "https://docs.aws.amazon.com/AmazonCloudFront/latest/DeveloperGuide/LocationsOfEdgeServers.html", UpdateFrequencyHint: "weekly", SupportedIPVersions: []int{4, 6}},
+	CloudFrontRegional: {DocsURL: "https://docs.aws.amazon.com/AmazonCloudFront/latest/DeveloperGuide/LocationsOfEdgeServers.html", UpdateFrequencyHint: "weekly", SupportedIPVersions: []int{4, 6}},
+	Edgecast:           {DocsURL: "https://docs.edg.io/applications/v7/reference/edgio_ip_addresses", UpdateFrequencyHint: "irregular", SupportedIPVersions: []int{4, 6}},
+	Fastly:             {DocsURL: "https://www.fastly.com/documentation/reference/api/utils/public-ip-list/", UpdateFrequencyHint: "irregular", SupportedIPVersions: []int{4}},
+	GCore:              {DocsURL: "https://api.gcore.com/docs/cdn#tag/IP-Addresses-List", UpdateFrequencyHint: "weekly", SupportedIPVersions: []int{4}},
+	Google:             {DocsURL: "https://support.google.com/a/answer/10026322", UpdateFrequencyHint: "daily", SupportedIPVersions: []int{4}},
+	Key:                {DocsURL: "https://www.keycdn.com/support/origin-shield", UpdateFrequencyHint: "irregular", SupportedIPVersions: []int{4}},
+	Mediahub:           {DocsURL: "https://www.mediahub.net/ip-addresses/", UpdateFrequencyHint: "irregular", SupportedIPVersions: []int{4, 6}},
+	Myra:               {DocsURL: "https://www.myrasecurity.com/en/knowledge-hub/ip-addresses/", UpdateFrequencyHint: "irregular", SupportedIPVersions: []int{4, 6}},
+	PerimeterX:         {UpdateFrequencyHint: "irregular", SupportedIPVersions: []int{4}},
+	Quic:               {DocsURL: "https://docs.quic.cloud/qc-cdn/qc-cdn-quick-start/", UpdateFrequencyHint: "daily", SupportedIPVersions: []int{4, 6}},
+	Reblaze:            {DocsURL: "https://gb.docs.reblaze.com/reference-information/reblaze-ip-addresses", UpdateFrequencyHint: "irregular", SupportedIPVersions: []int{4}},
+	Section:            {DocsURL: "https://www.section.io/docs/", UpdateFrequencyHint: "irregular", SupportedIPVersions: []int{4}},
+	Yandex:             {DocsURL: "https://yandex.cloud/en/docs/cdn/", UpdateFrequencyHint: "irregular", SupportedIPVersions: []int{4, 6}},
+	MaxCDNHistorical:   {UpdateFrequencyHint: "never", SupportedIPVersions: []int{4}},
+}
+
+// Meta describes the provider. Providers that aren't built in get only
+// their name and source URL.
+func (dp defaultProvider) Meta() ProviderMeta {
+	meta := builtinMeta[dp.name]
+	meta.Name = dp.name
+	meta.SourceURL = dp.url
+	meta.SupportedIPVersions = slices.Clone(meta.SupportedIPVersions)
+	return meta
+}
+
+// GetProviderMeta describes the named provider of the default client.
+func GetProviderMeta(name string) (ProviderMeta, error) {
+	return defaultClient.GetProviderMeta(name)
+}
+
+// GetProviderMeta describes the named provider.
+func (cl *Client) GetProviderMeta(name string) (ProviderMeta, error) {
+	pro, err := cl.GetProvider(name)
+	if err != nil {
+		return ProviderMeta{}, err
+	}
+	meta := pro.Meta()
+	meta.Name = name
+	return meta, nil
+}
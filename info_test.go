@@ -0,0 +1,35 @@
+package cdn
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestGetProviderMeta(t *testing.T) {
+	for name := range builtinFactories {
+		meta, err := GetProviderMeta(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if meta.Name != name || meta.UpdateFrequencyHint == "" || len(meta.SupportedIPVersions) == 0 {
+			t.Errorf("%s: incomplete metadata %+v", name, meta)
+		}
+	}
+	meta, err := GetProviderMeta(CloudFlare)
+	if err != nil || meta.SourceURL != "https://www.cloudflare.com/ips-v4" || !slices.Equal(meta.SupportedIPVersions, []int{4}) {
+		t.Errorf("GetProviderMeta(cloudflare) = %+v, %v", meta, err)
+	}
+
+	if meta, _ := GetProviderMeta(CacheFly); meta.DocsURL == meta.SourceURL {
+		t.Errorf("GetProviderMeta(cachefly).DocsURL = %q, the data file", meta.DocsURL)
+	}
+
+	withProviders(t, newStaticProvider("custom"))
+	if meta, err := GetProviderMeta("custom"); err != nil || meta.Name != "custom" || meta.SourceURL != "https://example.com/custom" || meta.DocsURL != "" {
+		t.Errorf("GetProviderMeta(custom) = %+v, %v", meta, err)
+	}
+	if _, err := GetProviderMeta("missing"); !errors.Is(err, ErrProviderNotFound) {
+		t.Errorf("GetProviderMeta(missing) error = %v; want ErrProviderNotFound", err)
+	}
+}
@@ -0,0 +1,66 @@
+package cdn
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// maxIPSetName is the longest set name ipset accepts.
+const maxIPSetName = 31
+
+// ExportIPSet writes an ipset restore script for providers of the default
+// client; see Client.ExportIPSet.
+func ExportIPSet(w io.Writer, setName string, providers ...string) error {
+	return defaultClient.ExportIPSet(w, setName, providers...)
+}
+
+// ExportIPSet writes a script for "ipset restore -exist" that fills the set
+// setName, of type hash:net and family inet, with the IPv4 ranges of the
+// named providers, or of every provider in use if none are named, and the
+// set <setName>-v6 of family inet6 with their IPv6 ranges. Both sets are
+// created if missing and flushed, so that the script can be reloaded, and
+// written even if empty, so that firewall rules can always refer to them.
+// Bare addresses become /32 or /128 ranges and overlapping or adjacent
+// ranges are merged to keep the sets small. Nothing is written if a
+// provider fails.
+func (cl *Client) ExportIPSet(w io.Writer, setName string, providers ...string) error {
+	if setName == "" || strings.ContainsFunc(setName, func(r rune) bool { return r <= ' ' }) || len(setName+"-v6") > maxIPSetName {
+		return fmt.Errorf("invalid ipset name %q: want up to %d characters without spaces, including the -v6 suffix", setName, maxIPSetName)
+	}
+	_, all, _, err := cl.selectedRanges(providers)
+	if err != nil {
+		return err
+	}
+	var v4, v6 []string
+	for _, r := range mergeRanges(all) {
+		if cidr := parseRange(r); len(cidr.IP) == net.IPv4len {
+			v4 = append(v4, r)
+		} else {
+			v6 = append(v6, r)
+		}
+	}
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	for _, set := range []struct {
+		name, family string
+		cidrs        []string
+	}{
+		{setName, "inet", v4},
+		{setName + "-v6", "inet6", v6},
+	} {
+		fmt.Fprintf(bw, "create %s hash:net family %s\n", set.name, set.family)
+		fmt.Fprintf(bw, "flush %s\n", set.name)
+		for _, cidr := range set.cidrs {
+			fmt.Fprintf(bw, "add %s %s\n", set.name, cidr)
+		}
+	}
+	if err = bw.Flush(); err != nil {
+		return err
+	}
+	_, err = buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,34 @@
+package cdn
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExportIPSet(t *testing.T) {
+	withProviders(t,
+		newStaticProvider("a", "192.0.2.0/25", "198.51.100.7", "2001:db8::/33", "2001:db9::1"),
+		newStaticProvider("b", "192.0.2.128/25", "203.0.113.0/24", "203.0.113.9", "2001:db8:8000::/33"),
+		newStaticProvider("c", "10.0.0.0/8"),
+	)
+	var buf bytes.Buffer
+	if err := ExportIPSet(&buf, "cdn", "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	golden, err := os.ReadFile("testdata/ipset.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != string(golden) {
+		t.Errorf("ipset script:\n%s\nwant:\n%s", buf.String(), golden)
+	}
+
+	for _, name := range []string{"", "cdn sets", strings.Repeat("x", 29)} {
+		buf.Reset()
+		if err := ExportIPSet(&buf, name, "a"); err == nil || buf.Len() != 0 {
+			t.Errorf("set name %q: err = %v, wrote %q", name, err, buf.String())
+		}
+	}
+}
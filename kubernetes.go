@@ -0,0 +1,86 @@
+package cdn
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// dns1123Label matches the names Kubernetes accepts for namespaces, which
+// the policy names are held to as well.
+var dns1123Label = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// ExportKubernetesNetworkPolicy writes a NetworkPolicy for the named provider
+// of the default client; see Client.ExportKubernetesNetworkPolicy.
+func ExportKubernetesNetworkPolicy(providerName string, w io.Writer, namespace string) error {
+	return defaultClient.ExportKubernetesNetworkPolicy(providerName, w, namespace)
+}
+
+// ExportKubernetesNetworkPolicy writes a Kubernetes NetworkPolicy named
+// cdn-<providerName>-egress to w as YAML. It selects every pod in namespace
+// and allows egress to each range of the named provider. An empty namespace
+// is left out, so that kubectl applies the policy to the current one. The
+// namespace and the policy name must be DNS-1123 labels. A provider without
+// ranges is an error rather than a policy with an empty peer list, which
+// Kubernetes would take to allow egress everywhere.
+func (cl *Client) ExportKubernetesNetworkPolicy(providerName string, w io.Writer, namespace string) error {
+	ipRanges, err := cl.FetchIPRangesNormalized(providerName)
+	if err != nil {
+		return err
+	}
+	return writeNetworkPolicy(w, "cdn-"+providerName+"-egress", namespace, ipRanges)
+}
+
+// ExportKubernetesNetworkPolicyAll writes a NetworkPolicy for all providers of
+// the default client; see Client.ExportKubernetesNetworkPolicyAll.
+func ExportKubernetesNetworkPolicyAll(w io.Writer, namespace string) error {
+	return defaultClient.ExportKubernetesNetworkPolicyAll(w, namespace)
+}
+
+// ExportKubernetesNetworkPolicyAll is like ExportKubernetesNetworkPolicy but
+// writes a single policy, cdn-all-egress, allowing the ranges of every
+// provider in use. Nothing is written if any provider fails, so that a
+// partial policy doesn't block traffic to a CDN.
+func (cl *Client) ExportKubernetesNetworkPolicyAll(w io.Writer, namespace string) error {
+	ranges, err := cl.AllRanges()
+	if err != nil {
+		return err
+	}
+	var all []string
+	for _, name := range cl.activeProviderNames() {
+		all = append(all, hostsAsCIDRs(ranges[name])...)
+	}
+	return writeNetworkPolicy(w, "cdn-all-egress", namespace, all)
+}
+
+func writeNetworkPolicy(w io.Writer, name, namespace string, cidrs []string) error {
+	if !dns1123Label.MatchString(name) {
+		return fmt.Errorf("invalid NetworkPolicy name %q: want a DNS-1123 label", name)
+	}
+	if namespace != "" && !dns1123Label.MatchString(namespace) {
+		return fmt.Errorf("invalid namespace %q: want a DNS-1123 label", namespace)
+	}
+	if len(cidrs) == 0 {
+		return fmt.Errorf("%w: %s would allow egress to everywhere", ErrNoValidRanges, name)
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "apiVersion: networking.k8s.io/v1")
+	fmt.Fprintln(bw, "kind: NetworkPolicy")
+	fmt.Fprintln(bw, "metadata:")
+	fmt.Fprintf(bw, "  name: %s\n", name)
+	if namespace != "" {
+		fmt.Fprintf(bw, "  namespace: %s\n", namespace)
+	}
+	fmt.Fprintln(bw, "spec:")
+	fmt.Fprintln(bw, "  podSelector: {}")
+	fmt.Fprintln(bw, "  policyTypes:")
+	fmt.Fprintln(bw, "  - Egress")
+	fmt.Fprintln(bw, "  egress:")
+	fmt.Fprintln(bw, "  - to:")
+	for _, cidr := range cidrs {
+		fmt.Fprintln(bw, "    - ipBlock:")
+		fmt.Fprintf(bw, "        cidr: %s\n", cidr)
+	}
+	return bw.Flush()
+}
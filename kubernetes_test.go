@@ -0,0 +1,83 @@
+package cdn
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestExportKubernetesNetworkPolicy(t *testing.T) {
+	withProviders(t,
+		newStaticProvider("a", "192.0.2.0/24", "2001:db8::/32"),
+		newStaticProvider("b", "198.51.100.7"),
+	)
+	var buf bytes.Buffer
+	if err := ExportKubernetesNetworkPolicy("a", &buf, "web"); err != nil {
+		t.Fatal(err)
+	}
+	want := `apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: cdn-a-egress
+  namespace: web
+spec:
+  podSelector: {}
+  policyTypes:
+  - Egress
+  egress:
+  - to:
+    - ipBlock:
+        cidr: 192.0.2.0/24
+    - ipBlock:
+        cidr: 2001:db8::/32
+`
+	if buf.String() != want {
+		t.Errorf("policy:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := ExportKubernetesNetworkPolicyAll(&buf, ""); err != nil {
+		t.Fatal(err)
+	}
+	want = `apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: cdn-all-egress
+spec:
+  podSelector: {}
+  policyTypes:
+  - Egress
+  egress:
+  - to:
+    - ipBlock:
+        cidr: 192.0.2.0/24
+    - ipBlock:
+        cidr: 2001:db8::/32
+    - ipBlock:
+        cidr: 198.51.100.7/32
+`
+	if buf.String() != want {
+		t.Errorf("combined policy:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	if err := ExportKubernetesNetworkPolicy("missing", &buf, ""); err == nil {
+		t.Error("unknown provider accepted")
+	}
+	buf.Reset()
+	for _, namespace := range []string{"Web", "web\n  labels: {}", "-web", strings.Repeat("w", 64)} {
+		if err := ExportKubernetesNetworkPolicy("a", &buf, namespace); err == nil || buf.Len() != 0 {
+			t.Errorf("namespace %q: err = %v, wrote %q", namespace, err, buf.String())
+		}
+	}
+}
+
+func TestWriteNetworkPolicyEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeNetworkPolicy(&buf, "cdn-a-egress", "", nil); !errors.Is(err, ErrNoValidRanges) || buf.Len() != 0 {
+		t.Errorf("no ranges: err = %v, wrote %q", err, buf.String())
+	}
+	if err := writeNetworkPolicy(&buf, "cdn-A_b-egress", "", []string{"192.0.2.0/24"}); err == nil {
+		t.Error("invalid name accepted")
+	}
+}
@@ -0,0 +1,36 @@
+package cdn
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+)
+
+// discardLogger is the logger until SetLogger installs another.
+var discardLogger = slog.New(discardHandler{})
+
+// currentLogger holds the logger set with SetLogger, nil meaning
+// discardLogger. It is atomic as logging happens from background refreshes.
+var currentLogger atomic.Pointer[slog.Logger]
+
+// SetLogger sets the logger used for fetch, cache and lookup events.
+// Passing nil restores the default, which discards everything. It is safe
+// to call while fetches are running.
+func SetLogger(l *slog.Logger) {
+	currentLogger.Store(l)
+}
+
+// logger returns the logger set with SetLogger.
+func logger() *slog.Logger {
+	if l := currentLogger.Load(); l != nil {
+		return l
+	}
+	return discardLogger
+}
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
@@ -0,0 +1,106 @@
+package cdn
+
+import (
+	"container/list"
+	"net"
+	"sync"
+	"time"
+)
+
+// lookupCache remembers the results of recent lookups, evicting the least
+// recently used once it holds size entries. A size of zero disables it.
+type lookupCache struct {
+	mu   sync.Mutex
+	size int
+	// gen is incremented by clear, so that a lookup that started before
+	// the reset doesn't store its outdated result.
+	gen     uint64
+	entries map[string]*list.Element
+	// order holds *lookupEntry values, most recently used first.
+	order list.List
+}
+
+type lookupEntry struct {
+	key     string
+	name    string
+	network *net.IPNet
+	added   time.Time
+}
+
+func lookupKey(ip net.IP) string {
+	return string(ip.To16())
+}
+
+// get returns the result stored for key if it is younger than maxAge, and
+// the generation to pass to put otherwise.
+func (lc *lookupCache) get(key string, maxAge time.Duration) (*lookupEntry, uint64) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if elem, ok := lc.entries[key]; ok {
+		entry := elem.Value.(*lookupEntry)
+		if time.Since(entry.added) < maxAge {
+			lc.order.MoveToFront(elem)
+			return entry, lc.gen
+		}
+		lc.remove(elem)
+	}
+	return nil, lc.gen
+}
+
+func (lc *lookupCache) put(gen uint64, key, name string, network *net.IPNet) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if lc.size == 0 || gen != lc.gen {
+		return
+	}
+	if elem, ok := lc.entries[key]; ok {
+		lc.remove(elem)
+	}
+	if lc.entries == nil {
+		lc.entries = make(map[string]*list.Element)
+	}
+	lc.entries[key] = lc.order.PushFront(&lookupEntry{key: key, name: name, network: network, added: time.Now()})
+	for lc.order.Len() > lc.size {
+		lc.remove(lc.order.Back())
+	}
+}
+
+func (lc *lookupCache) remove(elem *list.Element) {
+	delete(lc.entries, elem.Value.(*lookupEntry).key)
+	lc.order.Remove(elem)
+}
+
+// clear drops all entries.
+func (lc *lookupCache) clear() {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	lc.clearLocked()
+}
+
+func (lc *lookupCache) clearLocked() {
+	lc.gen++
+	lc.entries = nil
+	lc.order.Init()
+}
+
+func (lc *lookupCache) setSize(n int) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	lc.size = n
+	lc.clearLocked()
+}
+
+// SetLookupCacheSize sets the size of the default client's lookup cache;
+// see Client.SetLookupCacheSize.
+func SetLookupCacheSize(n int) {
+	defaultClient.SetLookupCacheSize(n)
+}
+
+// SetLookupCacheSize makes QueryName and QueryNameWithNetwork remember the
+// results for the n most recently looked up addresses, for callers that
+// see the same addresses over and over. The results are forgotten whenever
+// a provider's cache is written or the settings change, and once they are
+// older than the cache TTL. Zero, the default, disables the cache.
+func (cl *Client) SetLookupCacheSize(n int) {
+	cl.lookups.setSize(max(n, 0))
+}
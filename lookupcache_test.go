@@ -0,0 +1,111 @@
+package cdn
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLookupCache(t *testing.T) {
+	restoreConfig(t)
+	p := newStaticProvider("test", "192.0.2.0/24")
+	withProviders(t, p)
+	SetOptions(WithBogonFilter(false))
+	SetLookupCacheSize(2)
+	t.Cleanup(func() { SetLookupCacheSize(0) })
+
+	// The first lookup fetches the ranges, which invalidates its own result.
+	ip := net.ParseIP("192.0.2.1")
+	for i := 0; i < 2; i++ {
+		if name := QueryName(ip); name != "test" {
+			t.Fatalf("QueryName = %q; want test", name)
+		}
+	}
+	if entry, _ := defaultClient.lookups.get(lookupKey(ip), time.Hour); entry == nil || entry.name != "test" {
+		t.Fatalf("cached entry = %v", entry)
+	}
+
+	// A refresh of any provider must drop the remembered results.
+	if err := p.cache.store(cacheData{Timestamp: time.Now().Unix(), IPRanges: []string{"198.51.100.0/24"}}); err != nil {
+		t.Fatal(err)
+	}
+	if name := QueryName(ip); name != "" {
+		t.Errorf("QueryName after refresh = %q; want none", name)
+	}
+
+	for _, addr := range []string{"198.51.100.1", "198.51.100.2", "198.51.100.3"} {
+		QueryName(net.ParseIP(addr))
+	}
+	if n := defaultClient.lookups.order.Len(); n != 2 {
+		t.Errorf("cache holds %d entries; want 2", n)
+	}
+	if entry, _ := defaultClient.lookups.get(lookupKey(net.ParseIP("198.51.100.1")), time.Hour); entry != nil {
+		t.Error("least recently used entry not evicted")
+	}
+}
+
+func TestLookupCacheSkipsFailures(t *testing.T) {
+	restoreConfig(t)
+	ok, failing := newStaticProvider("ok", "192.0.2.0/24"), newStaticProvider("failing", "198.51.100.0/24")
+	failing.err = errors.New("unreachable")
+	withProviders(t, ok, failing)
+	SetOptions(WithBogonFilter(false))
+	SetLookupCacheSize(2)
+	t.Cleanup(func() { SetLookupCacheSize(0) })
+
+	ip := net.ParseIP("198.51.100.1")
+	for i := 0; i < 2; i++ {
+		if name := QueryName(ip); name != "" {
+			t.Fatalf("QueryName = %q; want none", name)
+		}
+	}
+	if entry, _ := defaultClient.lookups.get(lookupKey(ip), time.Hour); entry != nil {
+		t.Fatalf("result cached although a provider failed: %v", entry)
+	}
+	failing.err = nil
+	if name := QueryName(ip); name != "failing" {
+		t.Errorf("QueryName once the provider recovered = %q; want failing", name)
+	}
+}
+
+func TestLookupCacheDisabled(t *testing.T) {
+	restoreConfig(t)
+	withProviders(t, newStaticProvider("test", "192.0.2.0/24"))
+	QueryName(net.ParseIP("192.0.2.1"))
+	if n := defaultClient.lookups.order.Len(); n != 0 {
+		t.Errorf("disabled cache holds %d entries", n)
+	}
+}
+
+func BenchmarkLookupCache(b *testing.B) {
+	restoreConfig(b)
+	p := newStaticProvider("bench", mixedRanges(500)...)
+	SetCacheDir(b.TempDir())
+	// mixedRanges are private ranges, which QueryName skips by default.
+	SetOptions(WithBogonFilter(false))
+	old := defaultProviders()
+	Providers = map[string]provider{"bench": p}
+	b.Cleanup(func() {
+		Providers = old
+		SetCacheDir("")
+		SetLookupCacheSize(0)
+	})
+	ip := net.ParseIP("10.1.2.3")
+	if name := QueryName(ip); name != "bench" {
+		b.Fatalf("QueryName(%s) = %q; want bench", ip, name)
+	}
+
+	b.Run("off", func(b *testing.B) {
+		SetLookupCacheSize(0)
+		for i := 0; i < b.N; i++ {
+			QueryName(ip)
+		}
+	})
+	b.Run("on", func(b *testing.B) {
+		SetLookupCacheSize(1024)
+		for i := 0; i < b.N; i++ {
+			QueryName(ip)
+		}
+	})
+}
@@ -0,0 +1,138 @@
+package cdn
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MetricsHook receives measurements from fetches and lookups. Implementations
+// must be safe for concurrent use.
+type MetricsHook interface {
+	ObserveFetch(provider string, d time.Duration, err error)
+	ObserveLookup(result string)
+}
+
+// CacheObserver can optionally be implemented by a MetricsHook to be told
+// whether FetchIPRangesWithCache was served from the cache.
+type CacheObserver interface {
+	ObserveCache(provider string, hit bool)
+}
+
+// currentMetrics holds the hook set with SetMetricsHook, nil meaning none.
+// It is atomic as measurements are taken from background refreshes.
+var currentMetrics atomic.Pointer[MetricsHook]
+
+// SetMetricsHook installs h. Passing nil disables metrics. It is safe to
+// call while fetches and lookups are running.
+func SetMetricsHook(h MetricsHook) {
+	if h == nil {
+		currentMetrics.Store(nil)
+		return
+	}
+	currentMetrics.Store(&h)
+}
+
+// metrics returns the hook set with SetMetricsHook.
+func metrics() MetricsHook {
+	if h := currentMetrics.Load(); h != nil {
+		return *h
+	}
+	return noopMetrics{}
+}
+
+func observeCache(provider string, hit bool) {
+	if o, ok := metrics().(CacheObserver); ok {
+		o.ObserveCache(provider, hit)
+	}
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveFetch(string, time.Duration, error) {}
+func (noopMetrics) ObserveLookup(string)                      {}
+
+// Counters is a minimal in-memory MetricsHook. The zero value is ready to use.
+type Counters struct {
+	mu          sync.Mutex
+	fetches     map[string]int
+	fetchErrors map[string]int
+	fetchTime   map[string]time.Duration
+	cacheHits   map[string]int
+	cacheMisses map[string]int
+	lookups     map[string]int
+}
+
+func (c *Counters) init() {
+	if c.fetches == nil {
+		c.fetches = make(map[string]int)
+		c.fetchErrors = make(map[string]int)
+		c.fetchTime = make(map[string]time.Duration)
+		c.cacheHits = make(map[string]int)
+		c.cacheMisses = make(map[string]int)
+		c.lookups = make(map[string]int)
+	}
+}
+
+func (c *Counters) ObserveFetch(provider string, d time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.init()
+	if err != nil {
+		c.fetchErrors[provider]++
+	} else {
+		c.fetches[provider]++
+	}
+	c.fetchTime[provider] += d
+}
+
+func (c *Counters) ObserveLookup(result string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.init()
+	c.lookups[result]++
+}
+
+func (c *Counters) ObserveCache(provider string, hit bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.init()
+	if hit {
+		c.cacheHits[provider]++
+	} else {
+		c.cacheMisses[provider]++
+	}
+}
+
+// Fetches returns the number of successful and failed fetches for provider.
+func (c *Counters) Fetches(provider string) (succeeded, failed int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.fetches[provider], c.fetchErrors[provider]
+}
+
+// FetchDuration returns the total time spent fetching provider.
+func (c *Counters) FetchDuration(provider string) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.fetchTime[provider]
+}
+
+// CacheHitRatio returns the fraction of cached reads for provider that were
+// hits, or 0 if there were none.
+func (c *Counters) CacheHitRatio(provider string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	total := c.cacheHits[provider] + c.cacheMisses[provider]
+	if total == 0 {
+		return 0
+	}
+	return float64(c.cacheHits[provider]) / float64(total)
+}
+
+// Lookups returns how many lookups resolved to result ("" for no match).
+func (c *Counters) Lookups(result string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lookups[result]
+}
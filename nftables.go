@@ -0,0 +1,77 @@
+package cdn
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// nftElementsPerCommand is how many ranges ExportNftables puts in one add
+// element command, keeping lines short enough for nft's parser on lists
+// with thousands of ranges.
+const nftElementsPerCommand = 1000
+
+// nftIdentifier matches the table and set names nft accepts unquoted.
+var nftIdentifier = regexp.MustCompile(`^[A-Za-z_.][A-Za-z0-9/_.-]*$`)
+
+// ExportNftables writes an nft script filling named sets for providers of
+// the default client; see Client.ExportNftables.
+func ExportNftables(w io.Writer, table, set string, providers ...string) error {
+	return defaultClient.ExportNftables(w, table, set, providers...)
+}
+
+// ExportNftables writes a script for "nft -f" that fills the named set set
+// of the inet table table with the IPv4 ranges of the named providers, or
+// of every provider in use if none are named, and the set <set>-v6 with
+// their IPv6 ranges. The table and both interval sets are created if
+// missing and the sets flushed, so that the script can be reloaded. The
+// ranges are merged into the fewest prefixes, which also keeps nft from
+// rejecting overlapping intervals, and added at most
+// nftElementsPerCommand per command. Nothing is written if a provider
+// fails.
+func (cl *Client) ExportNftables(w io.Writer, table, set string, providers ...string) error {
+	for _, name := range []string{table, set} {
+		if !nftIdentifier.MatchString(name) {
+			return fmt.Errorf("invalid nftables name %q", name)
+		}
+	}
+	_, all, _, err := cl.selectedRanges(providers)
+	if err != nil {
+		return err
+	}
+	var v4, v6 []string
+	for _, r := range mergeRanges(all) {
+		if cidr := parseRange(r); len(cidr.IP) == net.IPv4len {
+			v4 = append(v4, r)
+		} else {
+			v6 = append(v6, r)
+		}
+	}
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	fmt.Fprintf(bw, "add table inet %s\n", table)
+	for _, s := range []struct {
+		name, typ string
+		cidrs     []string
+	}{
+		{set, "ipv4_addr", v4},
+		{set + "-v6", "ipv6_addr", v6},
+	} {
+		fmt.Fprintf(bw, "add set inet %s %s { type %s; flags interval; }\n", table, s.name, s.typ)
+		fmt.Fprintf(bw, "flush set inet %s %s\n", table, s.name)
+		for len(s.cidrs) > 0 {
+			n := min(len(s.cidrs), nftElementsPerCommand)
+			fmt.Fprintf(bw, "add element inet %s %s { %s }\n", table, s.name, strings.Join(s.cidrs[:n], ", "))
+			s.cidrs = s.cidrs[n:]
+		}
+	}
+	if err = bw.Flush(); err != nil {
+		return err
+	}
+	_, err = buf.WriteTo(w)
+	return err
+}
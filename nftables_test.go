@@ -0,0 +1,58 @@
+package cdn
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestExportNftables(t *testing.T) {
+	withProviders(t,
+		newStaticProvider("a", "192.0.2.0/25", "198.51.100.7", "2001:db8::/33"),
+		newStaticProvider("b", "192.0.2.128/25", "203.0.113.0/24", "2001:db8:8000::/33", "2001:db9::1"),
+	)
+	var buf bytes.Buffer
+	if err := ExportNftables(&buf, "filter", "cdn"); err != nil {
+		t.Fatal(err)
+	}
+	want := `add table inet filter
+add set inet filter cdn { type ipv4_addr; flags interval; }
+flush set inet filter cdn
+add element inet filter cdn { 192.0.2.0/24, 198.51.100.7/32, 203.0.113.0/24 }
+add set inet filter cdn-v6 { type ipv6_addr; flags interval; }
+flush set inet filter cdn-v6
+add element inet filter cdn-v6 { 2001:db8::/32, 2001:db9::1/128 }
+`
+	if buf.String() != want {
+		t.Errorf("nft script:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	for _, names := range [][2]string{{"filter", "cdn; flush ruleset"}, {"", "cdn"}, {"my table", "cdn"}} {
+		buf.Reset()
+		if err := ExportNftables(&buf, names[0], names[1], "a"); err == nil || buf.Len() != 0 {
+			t.Errorf("names %q: err = %v, wrote %q", names, err, buf.String())
+		}
+	}
+}
+
+func TestExportNftablesChunks(t *testing.T) {
+	var ipRanges []string
+	for i := 0; i < 2*nftElementsPerCommand+1; i++ {
+		ipRanges = append(ipRanges, fmt.Sprintf("10.%d.%d.0/24", i/128, i%128*2))
+	}
+	withProviders(t, newStaticProvider("large", ipRanges...))
+	var buf bytes.Buffer
+	if err := ExportNftables(&buf, "filter", "cdn"); err != nil {
+		t.Fatal(err)
+	}
+	var adds []int
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, "add element inet filter cdn {") {
+			adds = append(adds, strings.Count(line, ",")+1)
+		}
+	}
+	if want := []int{nftElementsPerCommand, nftElementsPerCommand, 1}; fmt.Sprint(adds) != fmt.Sprint(want) {
+		t.Errorf("add element commands with %v elements; want %v", adds, want)
+	}
+}
@@ -0,0 +1,107 @@
+package cdn
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ExportNginx writes allow directives for providers of the default client;
+// see Client.ExportNginx.
+func ExportNginx(w io.Writer, providers ...string) error {
+	return defaultClient.ExportNginx(w, providers...)
+}
+
+// ExportNginx writes an "allow <cidr>;" line for each range of the named
+// providers, or of every provider in use if none are named, for inclusion
+// in an nginx server or location block followed by "deny all;". The ranges
+// of all providers are merged into the fewest CIDRs and written in
+// canonical order. The comment header names the providers and the time of
+// the export, followed by when the newest of the ranges was fetched. Nothing
+// is written if a provider fails, so that a partial list doesn't lock a CDN
+// out.
+func (cl *Client) ExportNginx(w io.Writer, providers ...string) error {
+	return cl.exportMerged(w, providers, func(bw *bufio.Writer, cidrs []string) {
+		for _, cidr := range cidrs {
+			fmt.Fprintf(bw, "allow %s;\n", cidr)
+		}
+	})
+}
+
+// ExportNginxGeo writes an nginx geo block for providers of the default
+// client; see Client.ExportNginxGeo.
+func ExportNginxGeo(w io.Writer, providers ...string) error {
+	return defaultClient.ExportNginxGeo(w, providers...)
+}
+
+// ExportNginxGeo is like ExportNginx but writes a "geo $is_cdn" block that
+// sets $is_cdn to 1 for addresses in the ranges and to 0 otherwise, for use
+// in the http block, e.g. with "if ($is_cdn = 0) { return 403; }".
+func (cl *Client) ExportNginxGeo(w io.Writer, providers ...string) error {
+	return cl.exportMerged(w, providers, func(bw *bufio.Writer, cidrs []string) {
+		fmt.Fprintln(bw, "geo $is_cdn {")
+		fmt.Fprintln(bw, "    default 0;")
+		for _, cidr := range cidrs {
+			fmt.Fprintf(bw, "    %s 1;\n", cidr)
+		}
+		fmt.Fprintln(bw, "}")
+	})
+}
+
+// exportMerged writes the comment header shared by ExportNginx,
+// ExportNginxGeo and ExportHAProxy, then has body write the merged ranges of
+// the named providers.
+func (cl *Client) exportMerged(w io.Writer, providers []string, body func(*bufio.Writer, []string)) error {
+	providers, all, newest, err := cl.selectedRanges(providers)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	fmt.Fprintf(bw, "# Generated by github.com/yxw21/cdn for %s at %s.\n", strings.Join(providers, ", "), time.Now().UTC().Format(time.RFC3339))
+	if newest > 0 {
+		fmt.Fprintf(bw, "# Ranges as of %s.\n", time.Unix(newest, 0).UTC().Format(time.RFC3339))
+	}
+	body(bw, mergeRanges(all))
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// selectedRanges fetches the ranges of the named providers, or of every
+// provider in use if none are named, for the exporters that merge them. It
+// returns the sorted provider names, their ranges and the time the newest
+// of them was cached, zero if unknown, and fails if any provider does.
+func (cl *Client) selectedRanges(providers []string) (names, all []string, newest int64, err error) {
+	if len(providers) == 0 {
+		names = cl.activeProviderNames()
+	} else {
+		names = slices.Clone(providers)
+		slices.Sort(names)
+		names = slices.Compact(names)
+	}
+	for _, name := range names {
+		pro, err := cl.GetProvider(name)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		ipRanges, err := pro.FetchIPRangesWithCache(context.Background())
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("%s: %w", name, err)
+		}
+		all = append(all, ipRanges...)
+		if cm := cacheOf(pro); cm != nil {
+			if cache, err := cm.current(); err == nil {
+				newest = max(newest, cache.Timestamp)
+			}
+		}
+	}
+	return names, all, newest, nil
+}
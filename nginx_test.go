@@ -0,0 +1,84 @@
+package cdn
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportNginx(t *testing.T) {
+	a := newStaticProvider("a", "192.0.2.0/25", "198.51.100.7", "2001:db8::/32")
+	b := newStaticProvider("b", "192.0.2.128/25", "203.0.113.0/24")
+	c := newStaticProvider("c", "10.0.0.0/8")
+	withProviders(t, a, b, c)
+	written := time.Now().Add(-time.Hour).Unix()
+	for _, p := range []*staticProvider{a, b} {
+		if err := p.cache.store(cacheData{Timestamp: written - 60, IPRanges: p.ranges}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.cache.store(cacheData{Timestamp: written, IPRanges: b.ranges}); err != nil {
+		t.Fatal(err)
+	}
+	header := fmt.Sprintf("# Ranges as of %s.\n", time.Unix(written, 0).UTC().Format(time.RFC3339))
+
+	start := time.Now()
+	var buf bytes.Buffer
+	if err := ExportNginx(&buf, "b", "a"); err != nil {
+		t.Fatal(err)
+	}
+	want := header + `allow 192.0.2.0/24;
+allow 198.51.100.7/32;
+allow 203.0.113.0/24;
+allow 2001:db8::/32;
+`
+	if got := cutGeneratedHeader(t, buf.String(), "a, b", start); got != want {
+		t.Errorf("allow list:\n%s\nwant:\n%s", got, want)
+	}
+	var again bytes.Buffer
+	if err := ExportNginx(&again, "a", "b", "a"); err != nil || cutGeneratedHeader(t, again.String(), "a, b", start) != want {
+		t.Errorf("second export differs (%v):\n%s", err, again.String())
+	}
+
+	buf.Reset()
+	if err := ExportNginxGeo(&buf, "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	want = header + `geo $is_cdn {
+    default 0;
+    192.0.2.0/24 1;
+    198.51.100.7/32 1;
+    203.0.113.0/24 1;
+    2001:db8::/32 1;
+}
+`
+	if got := cutGeneratedHeader(t, buf.String(), "a, b", start); got != want {
+		t.Errorf("geo block:\n%s\nwant:\n%s", got, want)
+	}
+
+	buf.Reset()
+	c.err = errors.New("unreachable")
+	if err := ExportNginx(&buf); err == nil || buf.Len() != 0 {
+		t.Errorf("failing provider: err = %v, wrote %q", err, buf.String())
+	}
+	if err := ExportNginx(&buf, "missing"); !errors.Is(err, ErrProviderNotFound) {
+		t.Errorf("unknown provider: err = %v; want ErrProviderNotFound", err)
+	}
+}
+
+// cutGeneratedHeader checks that out starts with the generated-at line of
+// the merging exporters, naming providers and a time between start and now,
+// and returns the rest of out.
+func cutGeneratedHeader(t *testing.T, out, providers string, start time.Time) string {
+	t.Helper()
+	first, rest, _ := strings.Cut(out, "\n")
+	stamp, ok := strings.CutPrefix(first, "# Generated by github.com/yxw21/cdn for "+providers+" at ")
+	at, err := time.Parse(time.RFC3339, strings.TrimSuffix(stamp, "."))
+	if !ok || err != nil || at.Before(start.Truncate(time.Second)) || at.After(time.Now()) {
+		t.Errorf("header %q; want the providers %s and the time of the export", first, providers)
+	}
+	return rest
+}
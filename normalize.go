@@ -0,0 +1,45 @@
+package cdn
+
+import (
+	"context"
+	"net"
+	"strings"
+)
+
+// FetchIPRangesNormalized returns the ranges of the named provider of the
+// default client in CIDR notation; see Client.FetchIPRangesNormalized.
+func FetchIPRangesNormalized(providerName string) ([]string, error) {
+	return defaultClient.FetchIPRangesNormalized(providerName)
+}
+
+// FetchIPRangesNormalized returns the ranges of the named provider,
+// fetching them through the cache, with bare addresses, as published by
+// e.g. Bunny, CacheFly and quic.cloud, turned into /32 or /128 ranges.
+// CIDRs are returned unchanged.
+func (cl *Client) FetchIPRangesNormalized(providerName string) ([]string, error) {
+	pro, err := cl.GetProvider(providerName)
+	if err != nil {
+		return nil, err
+	}
+	ipRanges, err := pro.FetchIPRangesWithCache(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return hostsAsCIDRs(ipRanges), nil
+}
+
+// hostsAsCIDRs returns a copy of ipRanges with bare addresses written as
+// host ranges.
+func hostsAsCIDRs(ipRanges []string) []string {
+	result := make([]string, len(ipRanges))
+	for i, r := range ipRanges {
+		result[i] = r
+		if strings.Contains(r, "/") {
+			continue
+		}
+		if ip := net.ParseIP(r); ip != nil {
+			result[i] = hostNet(ip).String()
+		}
+	}
+	return result
+}
@@ -0,0 +1,23 @@
+package cdn
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestFetchIPRangesNormalized(t *testing.T) {
+	withProviders(t, newStaticProvider("hosts", "192.0.2.7", "198.51.100.0/24", "2001:db8::1", "2001:db8:1::/48", "::ffff:203.0.113.9"))
+	got, err := FetchIPRangesNormalized("hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"192.0.2.7/32", "198.51.100.0/24", "2001:db8::1/128", "2001:db8:1::/48", "203.0.113.9/32"}
+	if !slices.Equal(got, want) {
+		t.Errorf("FetchIPRangesNormalized = %v; want %v", got, want)
+	}
+	cached, _ := defaultProviders()["hosts"].FetchIPRangesWithCache(context.Background())
+	if cached[0] != "192.0.2.7" {
+		t.Errorf("normalizing changed the cached ranges to %v", cached)
+	}
+}
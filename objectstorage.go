@@ -0,0 +1,142 @@
+package cdn
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// ParseFunc extracts IP ranges from the contents of a stored object.
+type ParseFunc func(r io.Reader) ([]string, error)
+
+// ParseLines is a ParseFunc for objects with one range per line.
+func ParseLines(r io.Reader) ([]string, error) {
+	var result []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		result = append(result, scanner.Text())
+	}
+	return result, scanner.Err()
+}
+
+// objectStorageTags maps the object storage URL schemes to the build tags
+// that enable them.
+var objectStorageTags = map[string]string{
+	"s3": "cdn_s3",
+	"gs": "cdn_gcs",
+}
+
+// objectGetters open objects of the schemes in objectStorageTags, sending
+// their requests through httpc. They are registered by the files built with
+// those tags, so that the cloud SDKs are only compiled in when needed.
+var objectGetters = make(map[string]objectGetter)
+
+type objectGetter func(ctx context.Context, httpc *http.Client, object *url.URL) (io.ReadCloser, error)
+
+type objectStorageProvider struct {
+	defaultProvider
+	parse ParseFunc
+}
+
+func (o objectStorageProvider) FetchIPRanges() ([]string, error) {
+	var result []string
+	object, err := url.Parse(o.url)
+	if err != nil {
+		return result, err
+	}
+	var body io.ReadCloser
+	if get, ok := objectGetters[object.Scheme]; ok {
+		body, err = o.getObject(get, object)
+	} else {
+		var resp *http.Response
+		resp, err = o.get(o.url)
+		if err == nil {
+			body = resp.Body
+		}
+	}
+	if err != nil {
+		return result, err
+	}
+	defer body.Close()
+	result, err = o.parse(body)
+	if err != nil {
+		return nil, err
+	}
+	return o.processLines(result)
+}
+
+// getObject opens object with get under the same rules as requests made
+// with do: the rate limit, the request timeouts, the response size limit
+// and the HTTP client settings, such as proxies and TLS, apply.
+func (o objectStorageProvider) getObject(get objectGetter, object *url.URL) (io.ReadCloser, error) {
+	cl := o.owner()
+	c := cl.config()
+	ctx := o.fetchContext()
+	if lim := cl.limiter(o.name, object); lim != nil {
+		if err := lim.Wait(ctx); err != nil {
+			return nil, &FetchError{Provider: o.name, URL: object.String(), Err: err}
+		}
+	}
+	timeout := c.fetchTimeout
+	if d := c.requestTimeouts[o.name]; d > 0 && (timeout == 0 || d < timeout) {
+		timeout = d
+	}
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	body, err := get(ctx, cl.httpClient(o.name), object)
+	if err != nil {
+		cancel()
+		return nil, &FetchError{Provider: o.name, URL: object.String(), Err: err}
+	}
+	return o.limitBody(cancelOnClose{ReadCloser: body, cancel: cancel}, object.String(), c), nil
+}
+
+func (o objectStorageProvider) FetchIPRangesWithCache(ctx context.Context) ([]string, error) {
+	return o.fetchWithCache(ctx, o)
+}
+
+func (o objectStorageProvider) withContext(ctx context.Context) provider {
+	o.ctx = ctx
+	return o
+}
+
+// NewObjectStorageProvider returns a provider that reads its ranges from a
+// single object, e.g. a private mirror, parsed with parser (ParseLines if
+// nil). objectURL may be an https URL, fetched with the regular HTTP client,
+// or an s3:// or gs:// URL of the form scheme://bucket/key. S3 objects are
+// fetched with the AWS SDK and the default AWS credential chain, GCS objects
+// through the Cloud Storage API with Application Default Credentials; they
+// require building with the cdn_s3 or cdn_gcs tag respectively. Add the
+// provider to Providers to use it.
+func NewObjectStorageProvider(name string, objectURL string, parser ParseFunc) (provider, error) {
+	object, err := url.Parse(objectURL)
+	if err != nil {
+		return nil, err
+	}
+	if tag, ok := objectStorageTags[object.Scheme]; ok {
+		if _, ok = objectGetters[object.Scheme]; !ok {
+			return nil, fmt.Errorf("%s:// URLs need a build with the %s tag", object.Scheme, tag)
+		}
+		if object.Host == "" || len(object.Path) < 2 {
+			return nil, fmt.Errorf("object URL %q must be %s://bucket/key", objectURL, object.Scheme)
+		}
+	} else if err = defaultClient.validateSourceURL(objectURL); err != nil {
+		return nil, err
+	}
+	if parser == nil {
+		parser = ParseLines
+	}
+	return &objectStorageProvider{
+		defaultProvider: defaultProvider{
+			name:  name,
+			url:   objectURL,
+			cache: newCacheManager(name),
+		},
+		parse: parser,
+	}, nil
+}
@@ -0,0 +1,42 @@
+//go:build cdn_gcs
+
+package cdn
+
+import (
+	"context"
+	"fmt"
+	"golang.org/x/oauth2"
+	googleauth "golang.org/x/oauth2/google"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+func init() {
+	objectGetters["gs"] = getGCSObject
+}
+
+// getGCSObject reads gs://bucket/key through the Cloud Storage JSON API with
+// Application Default Credentials. httpc carries the token requests as well.
+func getGCSObject(ctx context.Context, httpc *http.Client, object *url.URL) (io.ReadCloser, error) {
+	client, err := googleauth.DefaultClient(context.WithValue(ctx, oauth2.HTTPClient, httpc), "https://www.googleapis.com/auth/devstorage.read_only")
+	if err != nil {
+		return nil, err
+	}
+	u := fmt.Sprintf("https://storage.googleapis.com/storage/v1/b/%s/o/%s?alt=media",
+		url.PathEscape(object.Host), url.PathEscape(strings.TrimPrefix(object.Path, "/")))
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: unexpected status %s", object, resp.Status)
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,34 @@
+//go:build cdn_s3
+
+package cdn
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+func init() {
+	objectGetters["s3"] = getS3Object
+}
+
+// getS3Object reads s3://bucket/key with the default AWS credential chain.
+func getS3Object(ctx context.Context, httpc *http.Client, object *url.URL) (io.ReadCloser, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithHTTPClient(httpc))
+	if err != nil {
+		return nil, err
+	}
+	out, err := s3.NewFromConfig(cfg).GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(object.Host),
+		Key:    aws.String(strings.TrimPrefix(object.Path, "/")),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
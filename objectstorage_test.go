@@ -0,0 +1,90 @@
+package cdn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestObjectStorageProviderHTTPS(t *testing.T) {
+	restoreConfig(t)
+	SetOptions(WithAllowInsecureHTTP(true))
+	srv := serveFile(t, "testdata/yandex.json")
+	parseJSON := func(r io.Reader) ([]string, error) {
+		var ranges []string
+		err := json.NewDecoder(r).Decode(&ranges)
+		return ranges, err
+	}
+	p, err := NewObjectStorageProvider("mirror", srv.URL+"/yandex.json", parseJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipRanges, err := p.FetchIPRanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"5.45.192.0/18", "87.250.224.0/19", "2a02:6b8::/29"}
+	if !slices.Equal(ipRanges, want) {
+		t.Errorf("FetchIPRanges = %v; want %v", ipRanges, want)
+	}
+}
+
+func TestNewObjectStorageProviderErrors(t *testing.T) {
+	if _, err := NewObjectStorageProvider("mirror", "ftp://mirror.example.com/ranges.txt", nil); err == nil {
+		t.Error("ftp URL accepted")
+	}
+	for scheme, tag := range objectStorageTags {
+		want := "bucket/key"
+		if _, built := objectGetters[scheme]; !built {
+			want = tag
+		}
+		_, err := NewObjectStorageProvider("mirror", scheme+"://bucket", nil)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s URL without key: error = %v; want it to mention %q", scheme, err, want)
+		}
+	}
+}
+
+func TestObjectStorageProviderLimits(t *testing.T) {
+	restoreConfig(t)
+	saved, built := objectGetters["s3"]
+	t.Cleanup(func() {
+		if built {
+			objectGetters["s3"] = saved
+		} else {
+			delete(objectGetters, "s3")
+		}
+	})
+	var deadline time.Time
+	objectGetters["s3"] = func(ctx context.Context, httpc *http.Client, object *url.URL) (io.ReadCloser, error) {
+		if httpc == nil {
+			t.Error("getter called without the client's HTTP client")
+		}
+		deadline, _ = ctx.Deadline()
+		return io.NopCloser(strings.NewReader("192.0.2.0/24\n198.51.100.0/24\n")), nil
+	}
+	p, err := NewObjectStorageProvider("bucket", "s3://bucket/ranges.txt", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SetOptions(WithRequestTimeout("bucket", time.Minute))
+	if ipRanges, err := p.FetchIPRanges(); err != nil || len(ipRanges) != 2 {
+		t.Fatalf("FetchIPRanges = %v, %v", ipRanges, err)
+	}
+	if deadline.IsZero() || time.Until(deadline) > time.Minute {
+		t.Errorf("getter deadline = %v; want the request timeout", deadline)
+	}
+
+	SetOptions(WithMaxResponseSize(16))
+	if _, err := p.FetchIPRanges(); !errors.Is(err, ErrResponseTooLarge) {
+		t.Errorf("oversized object: err = %v; want ErrResponseTooLarge", err)
+	}
+}
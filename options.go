@@ -0,0 +1,486 @@
+package cdn
+
+import (
+	"crypto/x509"
+	"fmt"
+	"golang.org/x/time/rate"
+	"io/fs"
+	"maps"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+type config struct {
+	debug                   bool
+	rootCAs                 *x509.CertPool
+	minTLSVersion           uint16
+	insecureSkipVerify      bool
+	cloudFrontIPLists       []string
+	maxResponseSize         int64
+	allowInsecureHTTP       bool
+	cacheDir                string
+	cacheTTL                time.Duration
+	fetchTimeout            time.Duration
+	providers               []string
+	proxy                   *url.URL
+	userAgent               string
+	disabledProviders       []string
+	providerCacheTTLs       map[string]time.Duration
+	ipVersion               int
+	maxConcurrency          int
+	cachePerm               os.FileMode
+	gCoreLists              []string
+	validate                ValidationHook
+	providerProxies         map[string]*url.URL
+	webhookURL              string
+	webhookSecret           string
+	rateLimits              map[string]rate.Limit
+	minRanges               map[string]int
+	staleWhileRevalidate    bool
+	requestTimeouts         map[string]time.Duration
+	googleScope             GoogleScope
+	history                 *HistoricalCacheBackend
+	akamaiAPIURL            string
+	akamaiAPIToken          string
+	noDiskCache             bool
+	maxInvalidCacheFraction float64
+	fallbackFS              fs.FS
+	noBogonFilter           bool
+	logParseFailures        bool
+}
+
+func defaultConfig() config {
+	return config{cacheTTL: defaultCacheTTL, validate: ValidateRanges, maxInvalidCacheFraction: defaultMaxInvalidCacheFraction}
+}
+
+// Option changes a setting; apply it with SetOptions or NewClient.
+type Option func(*config)
+
+// SetOptions applies opts to the default client in order.
+func SetOptions(opts ...Option) {
+	defaultClient.SetOptions(opts...)
+}
+
+// SetOptions applies opts in order. They take precedence over the settings
+// of ~/.cdnrc, even those loaded later with LoadRC.
+func (cl *Client) SetOptions(opts ...Option) {
+	cl.mu.Lock()
+	prevWebhookURL := cl.conf.webhookURL
+	for _, opt := range opts {
+		opt(&cl.conf)
+	}
+	cl.explicit = append(cl.explicit, opts...)
+	webhookURL := cl.conf.webhookURL
+	cl.mu.Unlock()
+	if webhookURL != "" && webhookURL != prevWebhookURL {
+		if err := cl.validateSourceURL(webhookURL); err != nil {
+			logger().Warn("webhook will not be delivered", "error", err)
+		}
+	}
+	cl.resetHTTPClient()
+	cl.lookups.clear()
+}
+
+// Options holds the general settings of a Client. Zero fields are left
+// unchanged by Configure.
+type Options struct {
+	// CacheDir is where cache files are kept (CDN_CACHE_DIR). The default is
+	// the user's home directory.
+	CacheDir string
+	// CacheTTL is how long fetched ranges are served from the cache before
+	// being refetched (CDN_CACHE_TTL, e.g. "24h"). The default is 7 days.
+	CacheTTL time.Duration
+	// FetchTimeout bounds each request to a provider endpoint
+	// (CDN_FETCH_TIMEOUT, e.g. "30s"). The default is no timeout.
+	FetchTimeout time.Duration
+	// Providers restricts QueryName, CheckAll and PreCache to the named
+	// providers (CDN_PROVIDERS, comma separated). The default is all
+	// registered providers.
+	Providers []string
+	// HTTPProxy is the proxy URL for provider requests (CDN_HTTP_PROXY). The
+	// default is taken from the standard proxy environment variables.
+	HTTPProxy string
+	// UserAgent is sent with provider requests instead of the defaults.
+	UserAgent string
+	// DisabledProviders are never used, even if listed in Providers.
+	DisabledProviders []string
+	// ProviderCacheTTLs overrides CacheTTL for individual providers.
+	ProviderCacheTTLs map[string]time.Duration
+	// IPVersion, if 4 or 6, restricts lookups to addresses and ranges of
+	// that IP version.
+	IPVersion int
+}
+
+// Configure applies the non-zero fields of o to the default client.
+func Configure(o Options) error {
+	return defaultClient.Configure(o)
+}
+
+// Configure applies the non-zero fields of o. Nothing is changed if any
+// field is invalid.
+func (cl *Client) Configure(o Options) error {
+	opt, err := cl.optionOf(o)
+	if err != nil {
+		return err
+	}
+	cl.SetOptions(opt)
+	return nil
+}
+
+// optionOf validates o and returns the Option applying its non-zero fields.
+func (cl *Client) optionOf(o Options) (Option, error) {
+	// The option may be replayed by LoadRC; it must not see later changes
+	// to the caller's slices and maps.
+	o.Providers = slices.Clone(o.Providers)
+	o.DisabledProviders = slices.Clone(o.DisabledProviders)
+	o.ProviderCacheTTLs = maps.Clone(o.ProviderCacheTTLs)
+	var proxy *url.URL
+	if o.HTTPProxy != "" {
+		u, err := url.Parse(o.HTTPProxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid HTTP proxy: %w", err)
+		}
+		proxy = u
+	}
+	for _, name := range append(slices.Clone(o.Providers), o.DisabledProviders...) {
+		if _, err := cl.GetProvider(name); err != nil {
+			return nil, err
+		}
+	}
+	if o.CacheTTL < 0 || o.FetchTimeout < 0 {
+		return nil, fmt.Errorf("durations must not be negative")
+	}
+	for name, ttl := range o.ProviderCacheTTLs {
+		if _, err := cl.GetProvider(name); err != nil {
+			return nil, err
+		}
+		if ttl <= 0 {
+			return nil, fmt.Errorf("cache TTL of %s must be positive", name)
+		}
+	}
+	if o.IPVersion != 0 && o.IPVersion != 4 && o.IPVersion != 6 {
+		return nil, fmt.Errorf("invalid IP version: %d", o.IPVersion)
+	}
+	return func(c *config) {
+		if o.CacheDir != "" {
+			c.cacheDir = o.CacheDir
+		}
+		if o.CacheTTL != 0 {
+			c.cacheTTL = o.CacheTTL
+		}
+		if o.FetchTimeout != 0 {
+			c.fetchTimeout = o.FetchTimeout
+		}
+		if len(o.Providers) > 0 {
+			c.providers = slices.Clone(o.Providers)
+		}
+		if proxy != nil {
+			c.proxy = proxy
+		}
+		if o.UserAgent != "" {
+			c.userAgent = o.UserAgent
+		}
+		if len(o.DisabledProviders) > 0 {
+			c.disabledProviders = slices.Clone(o.DisabledProviders)
+		}
+		if len(o.ProviderCacheTTLs) > 0 {
+			c.providerCacheTTLs = maps.Clone(o.ProviderCacheTTLs)
+		}
+		if o.IPVersion != 0 {
+			c.ipVersion = o.IPVersion
+		}
+	}, nil
+}
+
+// ConfigureFromEnv configures the default client from the environment; see
+// Client.ConfigureFromEnv.
+func ConfigureFromEnv() error {
+	return defaultClient.ConfigureFromEnv()
+}
+
+// ConfigureFromEnv calls Configure with the values of the CDN_CACHE_DIR,
+// CDN_CACHE_TTL, CDN_FETCH_TIMEOUT, CDN_PROVIDERS and CDN_HTTP_PROXY
+// environment variables. Unset variables leave their setting unchanged.
+func (cl *Client) ConfigureFromEnv() error {
+	var (
+		o   Options
+		err error
+	)
+	o.CacheDir = os.Getenv("CDN_CACHE_DIR")
+	if v := os.Getenv("CDN_CACHE_TTL"); v != "" {
+		if o.CacheTTL, err = time.ParseDuration(v); err != nil {
+			return fmt.Errorf("CDN_CACHE_TTL: %w", err)
+		}
+	}
+	if v := os.Getenv("CDN_FETCH_TIMEOUT"); v != "" {
+		if o.FetchTimeout, err = time.ParseDuration(v); err != nil {
+			return fmt.Errorf("CDN_FETCH_TIMEOUT: %w", err)
+		}
+	}
+	for _, name := range strings.Split(os.Getenv("CDN_PROVIDERS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			o.Providers = append(o.Providers, name)
+		}
+	}
+	o.HTTPProxy = os.Getenv("CDN_HTTP_PROXY")
+	return cl.Configure(o)
+}
+
+// CurrentOptions returns a snapshot of the default client's settings, for
+// debugging.
+func CurrentOptions() Options {
+	return defaultClient.CurrentOptions()
+}
+
+// CurrentOptions returns a snapshot of the current settings, for debugging.
+func (cl *Client) CurrentOptions() Options {
+	c := cl.config()
+	o := Options{
+		CacheDir:          c.cacheDir,
+		CacheTTL:          c.cacheTTL,
+		FetchTimeout:      c.fetchTimeout,
+		Providers:         slices.Clone(c.providers),
+		UserAgent:         c.userAgent,
+		DisabledProviders: slices.Clone(c.disabledProviders),
+		ProviderCacheTTLs: maps.Clone(c.providerCacheTTLs),
+		IPVersion:         c.ipVersion,
+	}
+	if c.proxy != nil {
+		o.HTTPProxy = c.proxy.String()
+	}
+	return o
+}
+
+// WithDebugMode makes QueryName compare the address with every range
+// instead of using its lookup index, and log each comparison (provider,
+// CIDR, match result) at debug level. It is slow and very verbose and
+// intended for development only.
+func WithDebugMode(enabled bool) Option {
+	return func(c *config) {
+		c.debug = enabled
+	}
+}
+
+// WithRootCAs sets the certificate authorities used to verify provider
+// endpoints, e.g. a corporate bundle for a TLS-intercepting proxy. nil
+// selects the system pool.
+func WithRootCAs(pool *x509.CertPool) Option {
+	return func(c *config) {
+		c.rootCAs = pool
+	}
+}
+
+// WithMinTLSVersion sets the minimum TLS version, such as tls.VersionTLS12,
+// accepted from provider endpoints.
+func WithMinTLSVersion(version uint16) Option {
+	return func(c *config) {
+		c.minTLSVersion = version
+	}
+}
+
+// WithDangerouslyInsecureSkipVerify disables certificate verification for
+// provider endpoints. Anyone on the network path can then feed arbitrary
+// ranges into the cache; use it only in lab environments.
+func WithDangerouslyInsecureSkipVerify(enabled bool) Option {
+	return func(c *config) {
+		c.insecureSkipVerify = enabled
+	}
+}
+
+// WithCloudFrontIPLists selects which lists of the CloudFront endpoint make
+// up the cloudfront provider, e.g. CloudFrontOriginFacingIPList. The default
+// is CloudFrontGlobalIPList and CloudFrontRegionalEdgeIPList. Ranges that
+// are already cached are used until they expire. FetchCloudFrontIPLists
+// reads other lists without changing the provider. A selected list missing
+// from the response fails the fetch with ErrUnexpectedFormat.
+func WithCloudFrontIPLists(lists ...string) Option {
+	return func(c *config) {
+		c.cloudFrontIPLists = lists
+	}
+}
+
+// WithMaxResponseSize caps the size of every provider response at n bytes;
+// a larger response fails with ErrResponseTooLarge. Zero restores the
+// defaults of 16 MiB, or more for providers known to serve large documents.
+func WithMaxResponseSize(n int64) Option {
+	return func(c *config) {
+		c.maxResponseSize = n
+	}
+}
+
+// WithAllowInsecureHTTP permits plain http source URLs and https to http
+// redirects, for internal mirrors that don't serve TLS.
+func WithAllowInsecureHTTP(enabled bool) Option {
+	return func(c *config) {
+		c.allowInsecureHTTP = enabled
+	}
+}
+
+// WithCachePermissions sets the mode of cache files, e.g. 0600 to keep
+// them private to the current user. The cache directory, if it has to be
+// created, gets the same mode plus search permission wherever the file mode
+// grants read. Zero restores the default of 0644.
+func WithCachePermissions(mode os.FileMode) Option {
+	return func(c *config) {
+		c.cachePerm = mode.Perm()
+	}
+}
+
+// WithDiskCache turns the cache files on or off. Without them fetched
+// ranges are only kept in memory, and nothing reads or writes the cache
+// directory, so the package also works without a home directory or on a
+// read-only filesystem. The default is on.
+func WithDiskCache(enabled bool) Option {
+	return func(c *config) {
+		c.noDiskCache = !enabled
+	}
+}
+
+// defaultMaxInvalidCacheFraction is the default of
+// WithMaxInvalidCacheFraction.
+const defaultMaxInvalidCacheFraction = 0.1
+
+// WithMaxInvalidCacheFraction sets the share of invalid entries, between 0
+// and 1, a cache file may contain before it is taken for corrupt and the
+// ranges are refetched. Below it the invalid entries are dropped. The
+// default is 0.1.
+func WithMaxInvalidCacheFraction(f float64) Option {
+	return func(c *config) {
+		c.maxInvalidCacheFraction = f
+	}
+}
+
+// WithGCoreLists adds the ranges of other Gcore products, e.g.
+// GCoreStreamingIPList, to the gcore provider, which by default only covers
+// the CDN. A list that can't be fetched is skipped with a warning. Ranges
+// that are already cached are used until they expire.
+func WithGCoreLists(lists ...string) Option {
+	return func(c *config) {
+		c.gCoreLists = lists
+	}
+}
+
+// WithProviderProxy sends the requests of the named provider through
+// proxyURL instead of the general proxy. nil removes the override.
+func WithProviderProxy(providerName string, proxyURL *url.URL) Option {
+	return func(c *config) {
+		c.providerProxies = maps.Clone(c.providerProxies)
+		if proxyURL == nil {
+			delete(c.providerProxies, providerName)
+			return
+		}
+		if c.providerProxies == nil {
+			c.providerProxies = make(map[string]*url.URL)
+		}
+		c.providerProxies[providerName] = proxyURL
+	}
+}
+
+// WithWebhook makes every refresh that changes a provider's cached ranges
+// POST a JSON document with the provider, the added and removed entries and
+// a timestamp to url. The hex HMAC-SHA256 of the body, keyed with secret, is
+// sent in the X-CDN-Signature header; with an empty secret the header is
+// left out rather than signed with an empty key. Delivery happens in the
+// background and is given up after 30 seconds; failures are logged, and
+// Client.WaitWebhooks waits for the deliveries in progress. Like a source
+// URL, url must use https unless WithAllowInsecureHTTP is set; otherwise
+// nothing is posted and a warning is logged. An empty url disables the
+// webhook.
+func WithWebhook(url string, secret string) Option {
+	return func(c *config) {
+		c.webhookURL = url
+		c.webhookSecret = secret
+	}
+}
+
+// WithMinRanges sets the fewest ranges a fetch of the named provider must
+// yield to be cached; a smaller result fails with ErrTooFewRanges and leaves
+// the cached ranges in place. Built-in providers whose lists are known to be
+// long have a default minimum; 0 turns the check off and a negative n
+// restores the default.
+func WithMinRanges(providerName string, n int) Option {
+	return func(c *config) {
+		c.minRanges = maps.Clone(c.minRanges)
+		if n < 0 {
+			delete(c.minRanges, providerName)
+			return
+		}
+		if c.minRanges == nil {
+			c.minRanges = make(map[string]int)
+		}
+		c.minRanges[providerName] = n
+	}
+}
+
+// WithRequestTimeout bounds each request to the named provider's endpoint
+// to d, on top of the FetchTimeout that applies to all providers, e.g. to
+// give a slow documentation page more time than an API. Zero removes the
+// override.
+func WithRequestTimeout(providerName string, d time.Duration) Option {
+	return func(c *config) {
+		c.requestTimeouts = maps.Clone(c.requestTimeouts)
+		if d <= 0 {
+			delete(c.requestTimeouts, providerName)
+			return
+		}
+		if c.requestTimeouts == nil {
+			c.requestTimeouts = make(map[string]time.Duration)
+		}
+		c.requestTimeouts[providerName] = d
+	}
+}
+
+// WithGoogleScope selects which Google ranges make up the google provider.
+// The default, GoogleEdgeOnly, leaves out the VMs of Google Cloud customers,
+// which are not a CDN; GoogleAll restores "any Google address". Ranges that
+// are already cached are used until they expire.
+func WithGoogleScope(scope GoogleScope) Option {
+	return func(c *config) {
+		c.googleScope = scope
+	}
+}
+
+// WithHistoricalCache makes every cache write also append the ranges to h,
+// keeping a record of past ranges next to the regular cache. Nil, the
+// default, stops recording.
+func WithHistoricalCache(h *HistoricalCacheBackend) Option {
+	return func(c *config) {
+		c.history = h
+	}
+}
+
+// WithFallbackFS sets the baseline ranges served when a provider can't be
+// fetched and has no cached ranges, not even expired ones, which are served
+// in preference, e.g. on first boot without network.
+// fsys holds a file per provider named <provider>.txt with one range per
+// line, typically an embed.FS bundled by the application; use fs.Sub to
+// select a directory of it. Fallback ranges are not cached, so the next
+// lookup tries the network again. Nil, the default, disables the fallback.
+func WithFallbackFS(fsys fs.FS) Option {
+	return func(c *config) {
+		c.fallbackFS = fsys
+	}
+}
+
+// WithBogonFilter makes QueryName answer "" for addresses for which
+// IsPrivateOrBogon is true without consulting any provider. It is on by
+// default; turn it off for providers registered with internal ranges.
+func WithBogonFilter(enabled bool) Option {
+	return func(c *config) {
+		c.noBogonFilter = !enabled
+	}
+}
+
+// WithParseFailureLogging makes every lookup log a warning with the number
+// of entries it skipped, per provider, because they didn't parse, e.g. in
+// ranges let through by a lenient validation hook. Such entries are always
+// skipped; the warning helps notice a source whose format is drifting. It
+// is off by default.
+func WithParseFailureLogging(enabled bool) Option {
+	return func(c *config) {
+		c.logParseFailures = enabled
+	}
+}
@@ -0,0 +1,130 @@
+package cdn
+
+import (
+	"context"
+	"maps"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// restoreConfig puts the package settings back as they were when the test
+// ends.
+func restoreConfig(t testing.TB) {
+	t.Helper()
+	cl := defaultClient
+	cl.mu.RLock()
+	saved, explicit, explicitURLs := cl.conf, cl.explicit, maps.Clone(cl.explicitURLs)
+	cl.mu.RUnlock()
+	t.Cleanup(func() {
+		cl.mu.Lock()
+		cl.conf, cl.explicit, cl.explicitURLs = saved, explicit, explicitURLs
+		cl.mu.Unlock()
+		cl.resetHTTPClient()
+		cl.lookups.clear()
+	})
+}
+
+func TestConfigurePartial(t *testing.T) {
+	restoreConfig(t)
+	if err := Configure(Options{CacheDir: "/tmp/cdn", FetchTimeout: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Configure(Options{CacheTTL: time.Hour, Providers: []string{CloudFlare}}); err != nil {
+		t.Fatal(err)
+	}
+	want := Options{
+		CacheDir:     "/tmp/cdn",
+		CacheTTL:     time.Hour,
+		FetchTimeout: time.Minute,
+		Providers:    []string{CloudFlare},
+	}
+	if got := CurrentOptions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("CurrentOptions = %+v; want %+v", got, want)
+	}
+}
+
+func TestConfigureIsAtomic(t *testing.T) {
+	restoreConfig(t)
+	before := CurrentOptions()
+	err := Configure(Options{CacheDir: "/tmp/elsewhere", Providers: []string{CloudFlare, "nope"}})
+	if err == nil {
+		t.Fatal("unknown provider accepted")
+	}
+	if got := CurrentOptions(); !reflect.DeepEqual(got, before) {
+		t.Errorf("failed Configure changed settings to %+v", got)
+	}
+}
+
+func TestConfigureFromEnv(t *testing.T) {
+	restoreConfig(t)
+	t.Setenv("CDN_CACHE_DIR", "/var/cache/cdn")
+	t.Setenv("CDN_CACHE_TTL", "12h")
+	t.Setenv("CDN_FETCH_TIMEOUT", "10s")
+	t.Setenv("CDN_PROVIDERS", "cloudflare, fastly")
+	t.Setenv("CDN_HTTP_PROXY", "http://proxy.internal:3128")
+	if err := ConfigureFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	want := Options{
+		CacheDir:     "/var/cache/cdn",
+		CacheTTL:     12 * time.Hour,
+		FetchTimeout: 10 * time.Second,
+		Providers:    []string{CloudFlare, Fastly},
+		HTTPProxy:    "http://proxy.internal:3128",
+	}
+	if got := CurrentOptions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("CurrentOptions = %+v; want %+v", got, want)
+	}
+
+	t.Setenv("CDN_CACHE_TTL", "a week")
+	if err := ConfigureFromEnv(); err == nil {
+		t.Error("invalid CDN_CACHE_TTL accepted")
+	}
+}
+
+func TestProviderSubset(t *testing.T) {
+	restoreConfig(t)
+	withProviders(t, newStaticProvider("a", "192.0.2.0/24"), newStaticProvider("b", "192.0.2.0/24"))
+	SetOptions(WithBogonFilter(false))
+	if err := Configure(Options{Providers: []string{"b"}}); err != nil {
+		t.Fatal(err)
+	}
+	result, err := CheckAll(context.Background(), net.ParseIP("192.0.2.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, map[string]bool{"b": true}) {
+		t.Errorf("CheckAll = %v", result)
+	}
+	if got := QueryName(net.ParseIP("192.0.2.1")); got != "b" {
+		t.Errorf("QueryName = %q; want b", got)
+	}
+}
+
+func TestSetEnabledProviders(t *testing.T) {
+	restoreConfig(t)
+	a, b := newStaticProvider("a", "192.0.2.0/24"), newStaticProvider("b", "198.51.100.0/24")
+	withProviders(t, a, b)
+	SetOptions(WithBogonFilter(false))
+	if err := SetEnabledProviders("a", "nope"); err == nil {
+		t.Fatal("unknown provider accepted")
+	}
+	if err := SetEnabledProviders("b"); err != nil {
+		t.Fatal(err)
+	}
+	PreCache()
+	if a.calls.Load() != 0 || b.calls.Load() != 1 {
+		t.Errorf("PreCache fetched a %d and b %d times; want only b", a.calls.Load(), b.calls.Load())
+	}
+	if got := QueryName(net.ParseIP("192.0.2.1")); got != "" {
+		t.Errorf("QueryName = %q; want disabled provider a to be skipped", got)
+	}
+	if err := SetEnabledProviders(); err != nil {
+		t.Fatal(err)
+	}
+	if got := QueryName(net.ParseIP("192.0.2.1")); got != "a" {
+		t.Errorf("QueryName = %q after enabling all providers; want a", got)
+	}
+}
@@ -0,0 +1,136 @@
+package cdn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+)
+
+// RangeSet is the parsed form of a provider's ranges, split by address
+// family. The zero RangeSet is empty.
+type RangeSet struct {
+	idx *rangeIndex
+}
+
+// GetRangeSet returns the ranges of the named provider of the default
+// client; see Client.GetRangeSet.
+func GetRangeSet(name string) (RangeSet, error) {
+	return defaultClient.GetRangeSet(name)
+}
+
+// GetRangeSet returns the ranges of the named provider, fetching them
+// through the cache. It shares the lookup index QueryName uses, so neither
+// has to parse the ranges again. Entries that don't parse are skipped.
+func (cl *Client) GetRangeSet(name string) (RangeSet, error) {
+	pro, err := cl.GetProvider(name)
+	if err != nil {
+		return RangeSet{}, err
+	}
+	ipRanges, err := pro.FetchIPRangesWithCache(context.Background())
+	if err != nil {
+		return RangeSet{}, err
+	}
+	return RangeSet{idx: indexOf(name, pro, ipRanges)}, nil
+}
+
+// BuildIndex builds the lookup indexes of the default client's providers;
+// see Client.BuildIndex.
+func BuildIndex(ctx context.Context) (map[string]RangeSet, error) {
+	return defaultClient.BuildIndex(ctx)
+}
+
+// BuildIndex fetches the ranges of every provider in use through the cache
+// and builds the lookup indexes QueryName uses, so that the first queries
+// don't have to, returning them keyed by provider. When ctx is done it
+// returns at once with the indexes built so far; the error then names each
+// provider that was skipped, as it does those that failed, and the fetches
+// that were cut short are cancelled.
+func (cl *Client) BuildIndex(ctx context.Context) (map[string]RangeSet, error) {
+	type build struct {
+		name string
+		rs   RangeSet
+		err  error
+	}
+	providers := cl.activeProviders()
+	builds := make(chan build, len(providers))
+	result := make(map[string]RangeSet, len(providers))
+	pending := make(map[string]bool, len(providers))
+	sem := newSemaphore(cl.config().maxConcurrency)
+	for name, pro := range providers {
+		pending[name] = true
+		go func(name string, pro provider) {
+			sem.acquire()
+			defer sem.release()
+			ipRanges, err := pro.FetchIPRangesWithCache(ctx)
+			if err != nil {
+				builds <- build{name: name, err: err}
+				return
+			}
+			builds <- build{name: name, rs: RangeSet{idx: indexOf(name, pro, ipRanges)}}
+		}(name, pro)
+	}
+	var errs []error
+	for len(pending) > 0 {
+		select {
+		case b := <-builds:
+			delete(pending, b.name)
+			if b.err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", b.name, b.err))
+				continue
+			}
+			result[b.name] = b.rs
+		case <-ctx.Done():
+			names := make([]string, 0, len(pending))
+			for name := range pending {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			for _, name := range names {
+				errs = append(errs, fmt.Errorf("%s: skipped: %w", name, ctx.Err()))
+			}
+			return result, errors.Join(errs...)
+		}
+	}
+	return result, errors.Join(errs...)
+}
+
+// V4 returns the IPv4 ranges, including IPv4-mapped ones, in 4-byte form.
+func (rs RangeSet) V4() []*net.IPNet {
+	if rs.idx == nil {
+		return nil
+	}
+	return slices.Clone(rs.idx.v4)
+}
+
+// V6 returns the IPv6 ranges.
+func (rs RangeSet) V6() []*net.IPNet {
+	if rs.idx == nil {
+		return nil
+	}
+	return slices.Clone(rs.idx.v6)
+}
+
+// Len returns the number of ranges of both families.
+func (rs RangeSet) Len() int {
+	if rs.idx == nil {
+		return 0
+	}
+	return len(rs.idx.v4) + len(rs.idx.v6)
+}
+
+// Contains reports whether ip is in one of the ranges. IPv4-mapped IPv6
+// addresses match IPv4 ranges.
+func (rs RangeSet) Contains(ip net.IP) bool {
+	if rs.idx == nil {
+		return false
+	}
+	if ip = normalizeIP(ip); ip == nil {
+		return false
+	}
+	if len(ip) == net.IPv4len {
+		return rs.idx.trie4.lookup(ip) != nil
+	}
+	return rs.idx.trie6.lookup(ip) != nil
+}
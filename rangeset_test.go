@@ -0,0 +1,96 @@
+package cdn
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetRangeSet(t *testing.T) {
+	withProviders(t, newStaticProvider("mixed",
+		"192.0.2.0/24", "198.51.100.7", "::ffff:203.0.113.0/120", "2001:db8::/32", "2001:db8:1::1",
+	))
+	rs, err := GetRangeSet("mixed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := rs.Len(); n != 5 {
+		t.Errorf("Len = %d; want 5", n)
+	}
+	for _, tt := range []struct {
+		nets []*net.IPNet
+		want []string
+	}{
+		{rs.V4(), []string{"192.0.2.0/24", "198.51.100.7/32", "203.0.113.0/24"}},
+		{rs.V6(), []string{"2001:db8::/32", "2001:db8:1::1/128"}},
+	} {
+		var got []string
+		for _, n := range tt.nets {
+			got = append(got, n.String())
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("family = %v; want %v", got, tt.want)
+		}
+	}
+	for addr, want := range map[string]bool{
+		"192.0.2.200":      true,
+		"198.51.100.7":     true,
+		"198.51.100.8":     false,
+		"203.0.113.9":      true,
+		"::ffff:192.0.2.1": true,
+		"2001:db8:ffff::1": true,
+		"2001:db9::1":      false,
+		"2001:db8:1::1":    true,
+		"203.0.114.1":      false,
+	} {
+		if got := rs.Contains(net.ParseIP(addr)); got != want {
+			t.Errorf("Contains(%s) = %v; want %v", addr, got, want)
+		}
+	}
+	if rs.Contains(nil) {
+		t.Error("Contains(nil) = true")
+	}
+
+	var empty RangeSet
+	if empty.Len() != 0 || empty.V4() != nil || empty.Contains(net.ParseIP("192.0.2.1")) {
+		t.Error("zero RangeSet isn't empty")
+	}
+	if _, err := GetRangeSet("missing"); !errors.Is(err, ErrProviderNotFound) {
+		t.Errorf("GetRangeSet(missing) error = %v; want ErrProviderNotFound", err)
+	}
+}
+
+func TestBuildIndexCancelled(t *testing.T) {
+	slow := newStaticProvider("slow", "198.51.100.0/24")
+	slow.delay = 2 * time.Second
+	failing := newStaticProvider("failing")
+	failing.err = errors.New("unreachable")
+	withProviders(t, newStaticProvider("fast", "192.0.2.0/24"), slow, failing)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	indexes, err := BuildIndex(ctx)
+	if elapsed := time.Since(start); elapsed >= slow.delay {
+		t.Errorf("BuildIndex took %v; want it to return on cancellation", elapsed)
+	}
+	if len(indexes) != 1 || !indexes["fast"].Contains(net.ParseIP("192.0.2.1")) {
+		t.Errorf("BuildIndex = %v; want only the fast provider's index", indexes)
+	}
+	if !errors.Is(err, context.Canceled) || !errors.Is(err, failing.err) {
+		t.Fatalf("BuildIndex error = %v; want context.Canceled and the failure", err)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "slow: skipped") || strings.Contains(msg, "fast") {
+		t.Errorf("BuildIndex error = %q; want only slow reported as skipped", msg)
+	}
+
+	indexes, err = BuildIndex(context.Background())
+	if err == nil || len(indexes) != 2 || indexes["slow"].Len() != 1 {
+		t.Errorf("BuildIndex = %v, %v; want slow and fast indexed and failing reported", indexes, err)
+	}
+}
@@ -0,0 +1,58 @@
+package cdn
+
+import (
+	"golang.org/x/time/rate"
+	"maps"
+	"net/url"
+)
+
+// SetRateLimit limits the default client's requests for the named provider;
+// see Client.SetRateLimit.
+func SetRateLimit(name string, r rate.Limit) {
+	defaultClient.SetRateLimit(name, r)
+}
+
+// SetRateLimit limits the requests made for the named provider to r per
+// second with a burst of one, e.g. rate.Every(time.Minute). The limit
+// applies per host: limited providers fetched from the same host share one
+// limiter, which allows the strictest of their limits. Zero or rate.Inf
+// removes the limit, which is the default.
+func (cl *Client) SetRateLimit(name string, r rate.Limit) {
+	cl.SetOptions(func(c *config) {
+		c.rateLimits = maps.Clone(c.rateLimits)
+		if r <= 0 || r == rate.Inf {
+			delete(c.rateLimits, name)
+			return
+		}
+		if c.rateLimits == nil {
+			c.rateLimits = make(map[string]rate.Limit)
+		}
+		c.rateLimits[name] = r
+	})
+	cl.limitMu.Lock()
+	cl.limiters = nil
+	cl.limitMu.Unlock()
+}
+
+// limiter returns the limiter for requests of the named provider to u, or
+// nil if the provider isn't rate limited.
+func (cl *Client) limiter(providerName string, u *url.URL) *rate.Limiter {
+	r, ok := cl.config().rateLimits[providerName]
+	if !ok {
+		return nil
+	}
+	cl.limitMu.Lock()
+	defer cl.limitMu.Unlock()
+	if cl.limiters == nil {
+		cl.limiters = make(map[string]*rate.Limiter)
+	}
+	lim, ok := cl.limiters[u.Host]
+	switch {
+	case !ok:
+		lim = rate.NewLimiter(r, 1)
+		cl.limiters[u.Host] = lim
+	case r < lim.Limit():
+		lim.SetLimit(r)
+	}
+	return lim
+}
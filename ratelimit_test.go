@@ -0,0 +1,82 @@
+package cdn
+
+import (
+	"fmt"
+	"golang.org/x/time/rate"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetRateLimit(t *testing.T) {
+	restoreConfig(t)
+	var (
+		mu    sync.Mutex
+		times []time.Time
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+		fmt.Fprintln(w, "192.0.2.0/24")
+	}))
+	defer srv.Close()
+	p := newCloudFlare()
+	p.url = srv.URL
+
+	const interval = 200 * time.Millisecond
+	SetRateLimit(CloudFlare, rate.Every(interval))
+	for i := 0; i < 2; i++ {
+		if _, err := p.FetchIPRanges(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if gap := times[1].Sub(times[0]); gap < interval*3/4 {
+		t.Errorf("second request %v after the first; want about %v", gap, interval)
+	}
+
+	SetRateLimit(CloudFlare, rate.Inf)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := p.FetchIPRanges(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed >= interval {
+		t.Errorf("unlimited fetches took %v", elapsed)
+	}
+}
+
+func TestSetRateLimitSharedHost(t *testing.T) {
+	restoreConfig(t)
+	var (
+		mu    sync.Mutex
+		times []time.Time
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+		fmt.Fprintln(w, "192.0.2.0/24")
+	}))
+	defer srv.Close()
+	fast, slow := newCloudFlare(), newCloudFlare()
+	fast.name, fast.url = "fast", srv.URL+"/fast"
+	slow.name, slow.url = "slow", srv.URL+"/slow"
+
+	// The host's limiter is created at the lenient rate; once slow has
+	// fetched, the strict one must govern fast too.
+	const interval = 200 * time.Millisecond
+	SetRateLimit("fast", rate.Every(time.Millisecond))
+	SetRateLimit("slow", rate.Every(interval))
+	for _, p := range []*cloudFlare{fast, slow, fast} {
+		if _, err := p.FetchIPRanges(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if gap := times[2].Sub(times[1]); gap < interval*3/4 {
+		t.Errorf("fast request %v after the slow one; want about %v", gap, interval)
+	}
+}
@@ -0,0 +1,128 @@
+package cdn
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// rcFile is the format of ~/.cdnrc; see cdnrc.example.
+type rcFile struct {
+	CacheDir          string            `json:"cacheDir"`
+	CacheTTL          string            `json:"cacheTTL"`
+	CacheTTLs         map[string]string `json:"cacheTTLs"`
+	FetchTimeout      string            `json:"fetchTimeout"`
+	Providers         []string          `json:"providers"`
+	DisabledProviders []string          `json:"disabledProviders"`
+	URLs              map[string]string `json:"urls"`
+	HTTPProxy         string            `json:"httpProxy"`
+	UserAgent         string            `json:"userAgent"`
+	IPVersion         int               `json:"ipVersion"`
+}
+
+// LoadRC applies the settings in ~/.cdnrc to the default client; see
+// Client.LoadRC.
+func LoadRC() error {
+	return defaultClient.LoadRC()
+}
+
+// LoadRC applies the settings in ~/.cdnrc, a JSON file documented by
+// cdnrc.example, as defaults: settings made in code with Configure,
+// SetOptions or SetProviderURL take precedence, whether they were made
+// before or after. Loading the file again replaces the settings it made
+// before. It returns nil if the file doesn't exist. NewClient loads the file
+// for the clients it creates.
+func (cl *Client) LoadRC() error {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	return cl.loadRCFile(filepath.Join(home, ".cdnrc"))
+}
+
+func (cl *Client) loadRCFile(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var rc rcFile
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&rc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	o := Options{
+		CacheDir:          rc.CacheDir,
+		Providers:         rc.Providers,
+		DisabledProviders: rc.DisabledProviders,
+		HTTPProxy:         rc.HTTPProxy,
+		UserAgent:         rc.UserAgent,
+		IPVersion:         rc.IPVersion,
+	}
+	if o.CacheTTL, err = parseRCDuration(rc.CacheTTL); err != nil {
+		return fmt.Errorf("%s: cacheTTL: %w", path, err)
+	}
+	if o.FetchTimeout, err = parseRCDuration(rc.FetchTimeout); err != nil {
+		return fmt.Errorf("%s: fetchTimeout: %w", path, err)
+	}
+	for name, v := range rc.CacheTTLs {
+		ttl, err := parseRCDuration(v)
+		if err != nil {
+			return fmt.Errorf("%s: cacheTTLs.%s: %w", path, name, err)
+		}
+		if o.ProviderCacheTTLs == nil {
+			o.ProviderCacheTTLs = make(map[string]time.Duration)
+		}
+		o.ProviderCacheTTLs[name] = ttl
+	}
+	setters := make(map[string]interface{ setURL(string) })
+	for name, u := range rc.URLs {
+		pro, err := cl.GetProvider(name)
+		if err != nil {
+			return fmt.Errorf("%s: urls: %w", path, err)
+		}
+		if err = cl.validateSourceURL(u); err != nil {
+			return fmt.Errorf("%s: urls: %w", path, err)
+		}
+		p, ok := pro.(interface{ setURL(string) })
+		if !ok {
+			return fmt.Errorf("%s: urls: CDN provider has no configurable URL: %s", path, name)
+		}
+		setters[name] = p
+	}
+	opt, err := cl.optionOf(o)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	cl.mu.Lock()
+	conf := defaultConfig()
+	opt(&conf)
+	for _, explicit := range cl.explicit {
+		explicit(&conf)
+	}
+	cl.conf = conf
+	for name, p := range setters {
+		if !cl.explicitURLs[name] {
+			p.setURL(rc.URLs[name])
+		}
+	}
+	cl.mu.Unlock()
+	cl.resetHTTPClient()
+	cl.lookups.clear()
+	return nil
+}
+
+func parseRCDuration(v string) (time.Duration, error) {
+	if v == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(v)
+}
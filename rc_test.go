@@ -0,0 +1,104 @@
+package cdn
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadRC(t *testing.T) {
+	restoreConfig(t)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := LoadRC(); err != nil {
+		t.Fatalf("LoadRC without .cdnrc: %v", err)
+	}
+
+	rc := `{"cacheTTL": "1h", "disabledProviders": ["akamai"], "urls": {"cloudflare": "https://mirror.example.com/ips-v4"}}`
+	if err := os.WriteFile(filepath.Join(home, ".cdnrc"), []byte(rc), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cloudflare := defaultProviders()[CloudFlare].(*cloudFlare)
+	defer cloudflare.setURL(cloudflare.url)
+	if err := LoadRC(); err != nil {
+		t.Fatal(err)
+	}
+	o := CurrentOptions()
+	if o.CacheTTL != time.Hour || len(o.DisabledProviders) != 1 {
+		t.Errorf("CurrentOptions = %+v", o)
+	}
+	if _, active := defaultClient.activeProviders()[Akamai]; active {
+		t.Error("akamai still active")
+	}
+	if cloudflare.url != "https://mirror.example.com/ips-v4" {
+		t.Errorf("cloudflare url = %s", cloudflare.url)
+	}
+
+	if err := Configure(Options{CacheTTL: 2 * time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := CurrentOptions().CacheTTL; ttl != 2*time.Hour {
+		t.Errorf("explicit setting did not override .cdnrc: CacheTTL = %v", ttl)
+	}
+}
+
+func TestLoadRCUnderExplicitSettings(t *testing.T) {
+	restoreConfig(t)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	rc := `{"cacheTTL": "1h", "userAgent": "rc/1.0", "urls": {"cloudflare": "https://mirror.example.com/ips-v4"}}`
+	if err := os.WriteFile(filepath.Join(home, ".cdnrc"), []byte(rc), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Settings made in code before LoadRC survive it.
+	cloudflare := defaultProviders()[CloudFlare].(*cloudFlare)
+	defer cloudflare.setURL(cloudflare.url)
+	if err := Configure(Options{CacheTTL: 2 * time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetProviderURL(CloudFlare, "https://code.example.com/ips-v4"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := LoadRC(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if o := CurrentOptions(); o.CacheTTL != 2*time.Hour || o.UserAgent != "rc/1.0" {
+		t.Errorf("CurrentOptions = %+v; want the explicit TTL and the .cdnrc user agent", o)
+	}
+	if cloudflare.url != "https://code.example.com/ips-v4" {
+		t.Errorf("cloudflare url = %s; want the one set in code", cloudflare.url)
+	}
+
+	// NewClient reads the file under its options.
+	cl := NewClient(func(c *config) { c.cacheTTL = 3 * time.Hour })
+	if o := cl.CurrentOptions(); o.CacheTTL != 3*time.Hour || o.UserAgent != "rc/1.0" {
+		t.Errorf("NewClient options = %+v; want the explicit TTL and the .cdnrc user agent", o)
+	}
+	if pro, _ := cl.GetProvider(CloudFlare); pro.(*cloudFlare).url != "https://mirror.example.com/ips-v4" {
+		t.Errorf("NewClient cloudflare url = %s", pro.(*cloudFlare).url)
+	}
+}
+
+func TestLoadRCRejectsUnknownFields(t *testing.T) {
+	restoreConfig(t)
+	path := filepath.Join(t.TempDir(), ".cdnrc")
+	if err := os.WriteFile(path, []byte(`{"cacheTime": "1h"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := defaultClient.loadRCFile(path); err == nil {
+		t.Error("unknown field accepted")
+	}
+}
+
+func TestExampleRC(t *testing.T) {
+	restoreConfig(t)
+	cloudflare := defaultProviders()[CloudFlare].(*cloudFlare)
+	defer cloudflare.setURL(cloudflare.url)
+	if err := defaultClient.loadRCFile("cdnrc.example"); err != nil {
+		t.Fatal(err)
+	}
+}
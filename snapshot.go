@@ -0,0 +1,159 @@
+package cdn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"time"
+)
+
+type cacheSnapshot struct {
+	Version int
+	Caches  map[string]cacheData
+}
+
+// ExportCache writes the default client's cache to w; see
+// Client.ExportCache.
+func ExportCache(w io.Writer) error {
+	return defaultClient.ExportCache(w)
+}
+
+// ExportCache writes the on-disk cache of every provider in use to w as
+// a single JSON document, so that a cache built on one machine can be
+// distributed to others with ImportCache. Providers without a cache file are
+// skipped.
+func (cl *Client) ExportCache(w io.Writer) error {
+	snapshot := cacheSnapshot{Version: 1, Caches: make(map[string]cacheData)}
+	for _, name := range cl.activeProviderNames() {
+		cm := newCacheManager(name)
+		cm.client = cl
+		cache, _, err := cm.load()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		snapshot.Caches[name] = cache
+	}
+	return json.NewEncoder(w).Encode(snapshot)
+}
+
+// ImportCache imports a cache snapshot into the default client; see
+// Client.ImportCache.
+func ImportCache(r io.Reader) error {
+	return defaultClient.ImportCache(r)
+}
+
+// ImportCache reads a document produced by ExportCache and writes each
+// provider's cache into the configured cache directory, keeping the original
+// timestamps. Entries for providers that are not registered are ignored.
+func (cl *Client) ImportCache(r io.Reader) error {
+	var snapshot cacheSnapshot
+	if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+		return err
+	}
+	for name, cache := range snapshot.Caches {
+		pro, exists := cl.registry()[name]
+		if !exists {
+			logger().Warn("skipping cache of unknown provider", "provider", name)
+			continue
+		}
+		if !hasValidRange(cache.IPRanges) {
+			logger().Warn("skipping cache without valid ranges", "provider", name)
+			continue
+		}
+		cm := cacheOf(pro)
+		if cm == nil {
+			cm = newCacheManager(name)
+			cm.client = cl
+		}
+		if err := cm.store(cache); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CachedProviders lists the cache files of the default client; see
+// Client.CachedProviders.
+func CachedProviders() []string {
+	return defaultClient.CachedProviders()
+}
+
+// CachedProviders returns the sorted names of the providers that have a
+// cache file in the cache directory, whether or not it is still fresh. It
+// returns nil if the disk cache is disabled.
+func (cl *Client) CachedProviders() []string {
+	if cl.config().noDiskCache {
+		return nil
+	}
+	dir, err := cl.config().cacheDirPath()
+	if err != nil {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if name, ok := cacheFileProvider(entry.Name()); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateCaches checks the cache files of the default client's providers;
+// see Client.ValidateCaches.
+func ValidateCaches() map[string]error {
+	return defaultClient.ValidateCaches()
+}
+
+// ValidateCaches reads the cache file of every provider in use, bypassing
+// the in-memory copy, and returns the problem found with each, nil meaning
+// none: ErrCacheMiss for a missing file, a decoding error for one that
+// isn't valid JSON, ErrCacheExpired for stale ranges, ErrNoValidRanges if
+// no entry parses and ErrCacheCorrupt if some don't. It is meant for health
+// endpoints and changes nothing.
+func (cl *Client) ValidateCaches() map[string]error {
+	results := make(map[string]error)
+	for name, pro := range cl.activeProviders() {
+		cm := cacheOf(pro)
+		if cm == nil {
+			continue
+		}
+		results[name] = cm.validate()
+	}
+	return results
+}
+
+// validate checks the cache file for ValidateCaches.
+func (cm *cacheManager) validate() error {
+	cache, path, err := cm.load()
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrCacheMiss, path)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	_, report := normalizeLines(cache.IPRanges)
+	switch {
+	case report.Valid == 0:
+		return fmt.Errorf("%w: %s", ErrNoValidRanges, path)
+	case report.Invalid > 0:
+		return fmt.Errorf("%w: %d of %d entries of %s are invalid, e.g. %q", ErrCacheCorrupt, report.Invalid, report.Invalid+report.Valid, path, report.Samples)
+	case cm.expired(cache):
+		return fmt.Errorf("%w: %s written %s", ErrCacheExpired, path, time.Unix(cache.Timestamp, 0))
+	}
+	return nil
+}
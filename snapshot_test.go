@@ -0,0 +1,101 @@
+package cdn
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestExportImportCache(t *testing.T) {
+	SetCacheDir(t.TempDir())
+	defer SetCacheDir("")
+	want := []string{"103.21.244.0/22", "173.245.48.0/20"}
+	if err := newCacheManager(CloudFlare).write(want, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := ExportCache(&buf); err != nil {
+		t.Fatal(err)
+	}
+	SetCacheDir(t.TempDir())
+	if err := ImportCache(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := newCacheManager(CloudFlare).read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("imported %v; want %v", got, want)
+	}
+	if _, err := newCacheManager(Fastly).read(); err == nil {
+		t.Error("fastly cache should not exist after import")
+	}
+}
+
+func TestCachedProviders(t *testing.T) {
+	dir := t.TempDir()
+	SetCacheDir(dir)
+	defer SetCacheDir("")
+	for _, name := range []string{Fastly, CloudFlare, "custom"} {
+		if err := newCacheManager(name).write([]string{"192.0.2.0/24"}, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{".bashrc", "cdn.ip.range", ".cdn.ip.range"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{CloudFlare, "custom", Fastly}
+	if got := CachedProviders(); !slices.Equal(got, want) {
+		t.Errorf("CachedProviders = %v; want %v", got, want)
+	}
+}
+
+func TestValidateCaches(t *testing.T) {
+	good := newStaticProvider("good")
+	corrupt := newStaticProvider("corrupt")
+	expired := newStaticProvider("expired")
+	truncated := newStaticProvider("truncated")
+	missing := newStaticProvider("missing")
+	withProviders(t, good, corrupt, expired, truncated, missing)
+	now := time.Now().Unix()
+	for p, file := range map[*staticProvider]string{
+		good:      fmt.Sprintf(`{"Timestamp": %d, "IPRanges": ["192.0.2.0/24"]}`, now),
+		corrupt:   fmt.Sprintf(`{"Timestamp": %d, "IPRanges": ["192.0.2.0/24", "<html>"]}`, now),
+		expired:   fmt.Sprintf(`{"Timestamp": %d, "IPRanges": ["192.0.2.0/24"]}`, time.Now().Add(-2*defaultCacheTTL).Unix()),
+		truncated: fmt.Sprintf(`{"Timestamp": %d, "IPRanges": ["192.0`, now),
+	} {
+		path, err := p.cache.filePath()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(path, []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results := ValidateCaches()
+	if len(results) != 5 {
+		t.Fatalf("ValidateCaches = %v; want 5 results", results)
+	}
+	if err := results["good"]; err != nil {
+		t.Errorf("good: %v", err)
+	}
+	if err := results["truncated"]; err == nil {
+		t.Error("truncated: undecodable file reported valid")
+	}
+	for name, want := range map[string]error{"corrupt": ErrCacheCorrupt, "expired": ErrCacheExpired, "missing": ErrCacheMiss} {
+		if err := results[name]; !errors.Is(err, want) {
+			t.Errorf("%s: err = %v; want %v", name, err, want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package cdn
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+)
+
+// sortedRanges holds parsed ranges sorted by network address, with ranges
+// nested in another one dropped, so that the only range that can contain an
+// address is the last one starting at or before it.
+type sortedRanges struct {
+	v4, v6 []*net.IPNet
+}
+
+// PreProcessRanges parses ranges, CIDRs or bare IP addresses, into a form
+// that answers Contains with a binary search instead of a comparison with
+// every range. It fails on the first entry that doesn't parse.
+func PreProcessRanges(ranges []string) (sortedRanges, error) {
+	var sr sortedRanges
+	for _, r := range ranges {
+		cidr := parseRange(r)
+		if cidr == nil {
+			return sortedRanges{}, fmt.Errorf("invalid range %q", r)
+		}
+		if len(cidr.IP) == net.IPv4len {
+			sr.v4 = append(sr.v4, cidr)
+		} else {
+			sr.v6 = append(sr.v6, cidr)
+		}
+	}
+	sr.v4 = sortDisjoint(sr.v4)
+	sr.v6 = sortDisjoint(sr.v6)
+	return sr, nil
+}
+
+// sortDisjoint sorts nets by address, wider ranges first, and drops the
+// ones contained in an earlier range.
+func sortDisjoint(nets []*net.IPNet) []*net.IPNet {
+	slices.SortFunc(nets, compareNets)
+	var result []*net.IPNet
+	for _, n := range nets {
+		if len(result) > 0 && result[len(result)-1].Contains(n.IP) {
+			continue
+		}
+		result = append(result, n)
+	}
+	return result
+}
+
+// Contains reports whether ip is in one of the ranges.
+func (sr sortedRanges) Contains(ip net.IP) bool {
+	nets, key := sr.v6, ip.To16()
+	if ip4 := ip.To4(); ip4 != nil {
+		nets, key = sr.v4, ip4
+	}
+	if key == nil {
+		return false
+	}
+	// The first range starting after ip; its predecessor is the candidate.
+	i := sort.Search(len(nets), func(i int) bool {
+		return bytes.Compare(nets[i].IP, key) > 0
+	})
+	return i > 0 && nets[i-1].Contains(key)
+}
@@ -0,0 +1,73 @@
+package cdn
+
+import (
+	"net"
+	"testing"
+)
+
+func TestPreProcessRanges(t *testing.T) {
+	sr, err := PreProcessRanges([]string{
+		"10.1.0.0/16", "10.0.0.0/8", "192.0.2.128/25", "192.0.2.0/26", "198.51.100.7",
+		"2001:db8:1::/48", "2001:db8::/32", "2001:db9::1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sr.v4) != 4 || len(sr.v6) != 2 {
+		t.Errorf("v4 = %v, v6 = %v; want nested ranges dropped", sr.v4, sr.v6)
+	}
+	for ip, want := range map[string]bool{
+		"10.2.0.1":         true,
+		"10.1.255.255":     true,
+		"9.255.255.255":    false,
+		"11.0.0.0":         false,
+		"192.0.2.1":        true,
+		"192.0.2.64":       false,
+		"192.0.2.255":      true,
+		"198.51.100.7":     true,
+		"198.51.100.8":     false,
+		"::ffff:10.0.0.1":  true,
+		"2001:db8:ffff::1": true,
+		"2001:db9::1":      true,
+		"2001:db9::2":      false,
+		"::1":              false,
+	} {
+		if got := sr.Contains(net.ParseIP(ip)); got != want {
+			t.Errorf("Contains(%s) = %v; want %v", ip, got, want)
+		}
+	}
+	if sr.Contains(nil) {
+		t.Error("Contains(nil) = true")
+	}
+
+	if _, err := PreProcessRanges([]string{"192.0.2.0/24", "<br>"}); err == nil {
+		t.Error("invalid entry accepted")
+	}
+}
+
+// BenchmarkSortedRanges compares comparing an address with every range with
+// the binary search of PreProcessRanges.
+func BenchmarkSortedRanges(b *testing.B) {
+	ipRanges := mixedRanges(2000)
+	idx := newRangeIndex("bench", ipRanges)
+	sr, err := PreProcessRanges(ipRanges)
+	if err != nil {
+		b.Fatal(err)
+	}
+	ip := net.ParseIP("10.7.207.1")
+
+	b.Run("loop", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, cidr := range idx.v4 {
+				if cidr.Contains(ip) {
+					break
+				}
+			}
+		}
+	})
+	b.Run("sorted", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			sr.Contains(ip)
+		}
+	})
+}
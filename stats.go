@@ -0,0 +1,105 @@
+package cdn
+
+import "time"
+
+// ProviderStats counts the fetches a Client made to refresh a provider's
+// cache. A fetch fails if the provider can't be reached, its response can't
+// be parsed or the ranges are rejected or can't be cached. LastFetchAt is
+// the time of the last successful fetch; LastErrorAt and LastError describe
+// the last failed one. LastParse describes the entries of the last list
+// received, whether or not the fetch succeeded.
+type ProviderStats struct {
+	FetchCount  int64
+	FetchErrors int64
+	LastFetchAt time.Time
+	LastErrorAt time.Time
+	LastError   error
+	LastParse   ParseReport
+}
+
+// maxParseSamples is how many invalid entries a ParseReport quotes.
+const maxParseSamples = 5
+
+// ParseReport counts the entries of a fetched list that were kept as Valid
+// ranges and those dropped as Invalid, quoting the first few of the latter
+// in Samples. Blank and comment lines count as neither.
+type ParseReport struct {
+	Valid   int
+	Invalid int
+	Samples []string
+}
+
+// InvalidFraction returns the share of the entries that were invalid, or
+// zero if there were none, e.g. for alerting when a source's format
+// changes.
+func (r ParseReport) InvalidFraction() float64 {
+	if r.Valid+r.Invalid == 0 {
+		return 0
+	}
+	return float64(r.Invalid) / float64(r.Valid+r.Invalid)
+}
+
+func (cl *Client) recordParse(providerName string, report ParseReport) {
+	cl.statsMu.Lock()
+	defer cl.statsMu.Unlock()
+	if cl.stats == nil {
+		cl.stats = make(map[string]ProviderStats)
+	}
+	s := cl.stats[providerName]
+	s.LastParse = report
+	cl.stats[providerName] = s
+}
+
+func (cl *Client) recordFetch(providerName string, err error) {
+	cl.statsMu.Lock()
+	defer cl.statsMu.Unlock()
+	if cl.stats == nil {
+		cl.stats = make(map[string]ProviderStats)
+	}
+	s := cl.stats[providerName]
+	s.FetchCount++
+	if err != nil {
+		s.FetchErrors++
+		s.LastErrorAt = time.Now()
+		s.LastError = err
+	} else {
+		s.LastFetchAt = time.Now()
+	}
+	cl.stats[providerName] = s
+}
+
+// GetProviderStats returns the fetch statistics of the named provider of the
+// default client.
+func GetProviderStats(name string) (ProviderStats, error) {
+	return defaultClient.GetProviderStats(name)
+}
+
+// GetProviderStats returns the fetch statistics of the named provider. They
+// are zero if it hasn't been fetched yet.
+func (cl *Client) GetProviderStats(name string) (ProviderStats, error) {
+	if _, err := cl.GetProvider(name); err != nil {
+		return ProviderStats{}, err
+	}
+	cl.statsMu.Lock()
+	defer cl.statsMu.Unlock()
+	return cl.stats[name], nil
+}
+
+// GetAllProviderStats returns the fetch statistics of every provider of the
+// default client.
+func GetAllProviderStats() map[string]ProviderStats {
+	return defaultClient.GetAllProviderStats()
+}
+
+// GetAllProviderStats returns the fetch statistics of every registered
+// provider, keyed by name.
+func (cl *Client) GetAllProviderStats() map[string]ProviderStats {
+	registry := cl.registry()
+	cl.statsMu.Lock()
+	defer cl.statsMu.Unlock()
+	all := make(map[string]ProviderStats, len(registry))
+	for name := range registry {
+		all[name] = cl.stats[name]
+	}
+	return all
+}
@@ -0,0 +1,60 @@
+package cdn
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestProviderStats(t *testing.T) {
+	ok := newStaticProvider("stats-ok", "192.0.2.0/24")
+	failing := newStaticProvider("stats-failing")
+	failing.err = errors.New("unreachable")
+	withProviders(t, ok, failing)
+
+	for i := 0; i < 2; i++ {
+		if _, err := ok.FetchIPRangesWithCache(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	failing.FetchIPRangesWithCache(context.Background())
+
+	s, err := GetProviderStats("stats-ok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.FetchCount != 1 || s.FetchErrors != 0 || s.LastFetchAt.IsZero() || !s.LastErrorAt.IsZero() {
+		t.Errorf("stats-ok = %+v; want one successful fetch", s)
+	}
+	all := GetAllProviderStats()
+	if len(all) != 2 {
+		t.Errorf("GetAllProviderStats = %v; want both providers", all)
+	}
+	s = all["stats-failing"]
+	if s.FetchCount != 1 || s.FetchErrors != 1 || !s.LastFetchAt.IsZero() || !errors.Is(s.LastError, failing.err) {
+		t.Errorf("stats-failing = %+v; want one failed fetch", s)
+	}
+	if _, err := GetProviderStats("missing"); !errors.Is(err, ErrProviderNotFound) {
+		t.Errorf("unknown provider: err = %v", err)
+	}
+}
+
+func TestParseReport(t *testing.T) {
+	p := newCloudFlare()
+	p.url = serveText(t, "# edge ranges\n192.0.2.0/24\ncidr\n198.51.100.0/24\n203.0.113.0/24\n<br>\n")
+	if _, err := p.FetchIPRanges(); err != nil {
+		t.Fatal(err)
+	}
+	s, err := GetProviderStats(CloudFlare)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := s.LastParse
+	if r.Valid != 3 || r.Invalid != 2 || !slices.Equal(r.Samples, []string{"cidr", "<br>"}) {
+		t.Errorf("LastParse = %+v", r)
+	}
+	if f := r.InvalidFraction(); f != 0.4 {
+		t.Errorf("InvalidFraction = %v; want 0.4", f)
+	}
+}
@@ -0,0 +1,147 @@
+package cdn
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// terraformName matches the set names WriteTerraformWAFv2IPSetConfig
+// accepts, which must be valid both as Terraform identifiers and as AWS WAF
+// IP set names.
+var terraformName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]{0,127}$`)
+
+// ExportTerraformWAFv2IPSet writes the IPv4 ranges of the named provider of
+// the default client for aws_wafv2_ip_set; see
+// Client.ExportTerraformWAFv2IPSet.
+func ExportTerraformWAFv2IPSet(providerName string, w io.Writer, setName string) error {
+	return defaultClient.ExportTerraformWAFv2IPSet(providerName, w, setName)
+}
+
+// ExportTerraformWAFv2IPSet writes the IPv4 ranges of the named provider to
+// w as a JSON array of CIDRs that can be passed as the addresses argument of
+// an aws_wafv2_ip_set resource. A WAFv2 IP set holds addresses of one
+// version only, so the IPv6 ranges are written by
+// ExportTerraformWAFv2IPSet6, for a second set. The CIDRs are in the form
+// AWS WAF accepts, with the host bits cleared and bare addresses as /32 or
+// /128 ranges. setName is the name of the set the file is for; it must meet
+// the rules of WriteTerraformWAFv2IPSetConfig, which writes a configuration
+// that reads the file. Nothing is written if setName is invalid or a range
+// isn't a valid CIDR or address. An empty list is written as [], which
+// Terraform accepts.
+func (cl *Client) ExportTerraformWAFv2IPSet(providerName string, w io.Writer, setName string) error {
+	return cl.exportTerraformWAFv2IPSet(providerName, w, setName, 4)
+}
+
+// ExportTerraformWAFv2IPSet6 writes the IPv6 ranges of the named provider
+// of the default client for aws_wafv2_ip_set; see
+// Client.ExportTerraformWAFv2IPSet6.
+func ExportTerraformWAFv2IPSet6(providerName string, w io.Writer, setName string) error {
+	return defaultClient.ExportTerraformWAFv2IPSet6(providerName, w, setName)
+}
+
+// ExportTerraformWAFv2IPSet6 is like ExportTerraformWAFv2IPSet for the IPv6
+// ranges.
+func (cl *Client) ExportTerraformWAFv2IPSet6(providerName string, w io.Writer, setName string) error {
+	return cl.exportTerraformWAFv2IPSet(providerName, w, setName, 6)
+}
+
+func (cl *Client) exportTerraformWAFv2IPSet(providerName string, w io.Writer, setName string, ipVersion int) error {
+	if !terraformName.MatchString(setName) {
+		return fmt.Errorf("invalid IP set name %q", setName)
+	}
+	v4, v6, err := cl.wafv2Addresses(providerName)
+	if err != nil {
+		return err
+	}
+	addresses := v4
+	if ipVersion == 6 {
+		addresses = v6
+	}
+	return writeIndentedJSON(w, addresses)
+}
+
+// ExportTerraformWAFv2IPSetObject writes the ranges of the named provider of
+// the default client as one JSON object; see
+// Client.ExportTerraformWAFv2IPSetObject.
+func ExportTerraformWAFv2IPSetObject(providerName string, w io.Writer, setName string) error {
+	return defaultClient.ExportTerraformWAFv2IPSetObject(providerName, w, setName)
+}
+
+// ExportTerraformWAFv2IPSetObject is like ExportTerraformWAFv2IPSet but
+// writes both versions to one JSON object, {"name": setName,
+// "ipv4_addresses": [...], "ipv6_addresses": [...]}, for configurations that
+// create both sets from one file with jsondecode.
+func (cl *Client) ExportTerraformWAFv2IPSetObject(providerName string, w io.Writer, setName string) error {
+	v4, v6, err := cl.wafv2Addresses(providerName)
+	if err != nil {
+		return err
+	}
+	return writeIndentedJSON(w, struct {
+		Name          string   `json:"name"`
+		IPv4Addresses []string `json:"ipv4_addresses"`
+		IPv6Addresses []string `json:"ipv6_addresses"`
+	}{setName, v4, v6})
+}
+
+// wafv2Addresses returns the ranges of the named provider in the form AWS WAF
+// accepts, split by version, as non-nil lists.
+func (cl *Client) wafv2Addresses(providerName string) (v4, v6 []string, err error) {
+	ipRanges, err := cl.FetchIPRangesNormalized(providerName)
+	if err != nil {
+		return nil, nil, err
+	}
+	v4, v6 = []string{}, []string{}
+	for _, r := range ipRanges {
+		_, cidr, err := net.ParseCIDR(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %q is not in CIDR notation", providerName, r)
+		}
+		if cidr.IP.To4() != nil {
+			v4 = append(v4, cidr.String())
+		} else {
+			v6 = append(v6, cidr.String())
+		}
+	}
+	return v4, v6, nil
+}
+
+func writeIndentedJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// WriteTerraformWAFv2IPSetConfig writes a Terraform configuration to w that
+// reads the file at path, as written by ExportTerraformWAFv2IPSet or, for
+// ipVersion 6, ExportTerraformWAFv2IPSet6, with a local_file data source and creates an aws_wafv2_ip_set
+// named setName from it. Both blocks are labelled setName, which must be 1
+// to 128 letters, digits, underscores and hyphens, starting with a letter
+// or underscore. The set's scope is REGIONAL; change it to CLOUDFRONT for
+// sets used by CloudFront distributions.
+func WriteTerraformWAFv2IPSetConfig(w io.Writer, setName, path string, ipVersion int) error {
+	if !terraformName.MatchString(setName) {
+		return fmt.Errorf("invalid IP set name %q", setName)
+	}
+	if ipVersion != 4 && ipVersion != 6 {
+		return fmt.Errorf("invalid IP version %d: want 4 or 6", ipVersion)
+	}
+	if strings.Contains(path, "${") || strings.Contains(path, "%{") {
+		return fmt.Errorf("invalid path %q: template sequences aren't allowed", path)
+	}
+	_, err := fmt.Fprintf(w, `data "local_file" %[1]q {
+  filename = %[2]q
+}
+
+resource "aws_wafv2_ip_set" %[1]q {
+  name               = %[1]q
+  scope              = "REGIONAL"
+  ip_address_version = "IPV%[3]d"
+  addresses          = jsondecode(data.local_file.%[1]s.content)
+}
+`, setName, path, ipVersion)
+	return err
+}
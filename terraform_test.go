@@ -0,0 +1,94 @@
+package cdn
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestExportTerraformWAFv2IPSet(t *testing.T) {
+	withProviders(t,
+		newStaticProvider("a", "192.0.2.0/24", "198.51.100.7", "203.0.113.9/24", "2001:db8::1", "2001:db8::/32"),
+		newStaticProvider("v4", "192.0.2.0/24"),
+		newStaticProvider("junk", "192.0.2.0/24", "not-a-range"),
+	)
+	for _, tt := range []struct {
+		export   func(string, io.Writer, string) error
+		provider string
+		want     string
+	}{
+		{ExportTerraformWAFv2IPSet, "a", "[\n  \"192.0.2.0/24\",\n  \"198.51.100.7/32\",\n  \"203.0.113.0/24\"\n]\n"},
+		{ExportTerraformWAFv2IPSet6, "a", "[\n  \"2001:db8::1/128\",\n  \"2001:db8::/32\"\n]\n"},
+		{ExportTerraformWAFv2IPSet6, "v4", "[]\n"},
+	} {
+		var buf bytes.Buffer
+		if err := tt.export(tt.provider, &buf, "cdn_"+tt.provider); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("%s:\n%s\nwant:\n%s", tt.provider, buf.String(), tt.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := ExportTerraformWAFv2IPSet("a", &buf, "cdn a"); err == nil || buf.Len() != 0 {
+		t.Errorf("invalid set name: err = %v, wrote %q", err, buf.String())
+	}
+	if err := ExportTerraformWAFv2IPSet("junk", &buf, "cdn_junk"); err == nil || buf.Len() != 0 {
+		t.Errorf("invalid range: err = %v, wrote %q", err, buf.String())
+	}
+
+	if err := ExportTerraformWAFv2IPSetObject("a", &buf, "cdn-a"); err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+  "name": "cdn-a",
+  "ipv4_addresses": [
+    "192.0.2.0/24",
+    "198.51.100.7/32",
+    "203.0.113.0/24"
+  ],
+  "ipv6_addresses": [
+    "2001:db8::1/128",
+    "2001:db8::/32"
+  ]
+}
+`
+	if buf.String() != want {
+		t.Errorf("object:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestWriteTerraformWAFv2IPSetConfig(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteTerraformWAFv2IPSetConfig(&buf, "cdn_cloudflare_v4", "cdn/cloudflare-v4.json", 4); err != nil {
+		t.Fatal(err)
+	}
+	want := `data "local_file" "cdn_cloudflare_v4" {
+  filename = "cdn/cloudflare-v4.json"
+}
+
+resource "aws_wafv2_ip_set" "cdn_cloudflare_v4" {
+  name               = "cdn_cloudflare_v4"
+  scope              = "REGIONAL"
+  ip_address_version = "IPV4"
+  addresses          = jsondecode(data.local_file.cdn_cloudflare_v4.content)
+}
+`
+	if buf.String() != want {
+		t.Errorf("config:\n%s\nwant:\n%s", buf.String(), want)
+	}
+	for _, tt := range []struct {
+		name, path string
+		ipVersion  int
+	}{
+		{"1cdn", "cdn.json", 4},
+		{"cdn set", "cdn.json", 4},
+		{"cdn", "${path.module}/cdn.json", 4},
+		{"cdn", "cdn.json", 0},
+	} {
+		if err := WriteTerraformWAFv2IPSetConfig(&buf, tt.name, tt.path, tt.ipVersion); err == nil {
+			t.Errorf("WriteTerraformWAFv2IPSetConfig(%q, %q, %d) accepted", tt.name, tt.path, tt.ipVersion)
+		}
+	}
+}
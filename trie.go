@@ -0,0 +1,94 @@
+package cdn
+
+import (
+	"math/bits"
+	"net"
+)
+
+// cidrTrie is a path-compressed binary trie (a PATRICIA trie) over the bits
+// of the prefixes of one address family. A lookup follows the bits of the
+// address and so takes at most 32 or 128 steps however many prefixes are
+// stored.
+type cidrTrie struct {
+	root *trieNode
+}
+
+type trieNode struct {
+	// key holds the node's prefix; only its first plen bits are significant.
+	key  []byte
+	plen int
+	// cidr is the stored range ending at this node, nil for a node that
+	// only joins two branches.
+	cidr  *net.IPNet
+	child [2]*trieNode
+}
+
+// bitAt returns bit i of key, counting from the most significant bit.
+func bitAt(key []byte, i int) int {
+	return int(key[i/8]>>(7-i%8)) & 1
+}
+
+// commonBits returns how many leading bits a and b share, up to n.
+func commonBits(a, b []byte, n int) int {
+	for i := 0; i*8 < n; i++ {
+		if x := a[i] ^ b[i]; x != 0 {
+			return min(i*8+bits.LeadingZeros8(x), n)
+		}
+	}
+	return n
+}
+
+// insert adds cidr, whose IP must have the trie's address length. A range
+// that is already present is kept.
+func (t *cidrTrie) insert(cidr *net.IPNet) {
+	key := cidr.IP
+	plen, _ := cidr.Mask.Size()
+	p := &t.root
+	for {
+		n := *p
+		if n == nil {
+			*p = &trieNode{key: key, plen: plen, cidr: cidr}
+			return
+		}
+		common := commonBits(n.key, key, min(n.plen, plen))
+		if common == n.plen {
+			if plen == n.plen {
+				if n.cidr == nil {
+					n.cidr = cidr
+				}
+				return
+			}
+			p = &n.child[bitAt(key, n.plen)]
+			continue
+		}
+		// n and cidr diverge inside n's prefix: join them under a new node
+		// holding the shared part.
+		split := &trieNode{key: key, plen: common}
+		split.child[bitAt(n.key, common)] = n
+		if common == plen {
+			split.cidr = cidr
+		} else {
+			split.child[bitAt(key, common)] = &trieNode{key: key, plen: plen, cidr: cidr}
+		}
+		*p = split
+		return
+	}
+}
+
+// lookup returns the most specific range containing ip, which must have the
+// trie's address length, or nil.
+func (t *cidrTrie) lookup(ip []byte) *net.IPNet {
+	var best *net.IPNet
+	for n := t.root; n != nil; n = n.child[bitAt(ip, n.plen)] {
+		if commonBits(n.key, ip, n.plen) < n.plen {
+			break
+		}
+		if n.cidr != nil {
+			best = n.cidr
+		}
+		if n.plen == len(ip)*8 {
+			break
+		}
+	}
+	return best
+}
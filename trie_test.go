@@ -0,0 +1,59 @@
+package cdn
+
+import (
+	"math/rand"
+	"net"
+	"testing"
+)
+
+func TestCIDRTrie(t *testing.T) {
+	idx := newRangeIndex("test", []string{
+		"0.0.0.0/0", "10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24", "10.1.2.3",
+		"192.0.2.128/25", "192.0.2.0/25", "::ffff:198.51.100.0/120",
+		"2001:db8::/32", "2001:db8:1::/48", "2001:db8:1::1",
+	})
+	for ip, want := range map[string]string{
+		"10.1.2.3":        "10.1.2.3/32",
+		"10.1.2.4":        "10.1.2.0/24",
+		"10.1.3.1":        "10.1.0.0/16",
+		"10.2.0.1":        "10.0.0.0/8",
+		"11.0.0.1":        "0.0.0.0/0",
+		"192.0.2.1":       "192.0.2.0/25",
+		"192.0.2.200":     "192.0.2.128/25",
+		"198.51.100.1":    "198.51.100.0/24",
+		"2001:db8:1::1":   "2001:db8:1::1/128",
+		"2001:db8:1::2":   "2001:db8:1::/48",
+		"2001:db8:2::1":   "2001:db8::/32",
+		"2001:db9::1":     "<nil>",
+		"::ffff:10.1.2.3": "10.1.2.3/32",
+	} {
+		if got := idx.lookup("test", net.ParseIP(ip), config{}).String(); got != want {
+			t.Errorf("lookup(%s) = %s; want %s", ip, got, want)
+		}
+	}
+}
+
+func TestCIDRTrieMatchesScan(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	var ipRanges []string
+	for i := 0; i < 2000; i++ {
+		ip := net.IPv4(10, byte(rnd.Intn(4)), byte(rnd.Intn(256)), byte(rnd.Intn(256)))
+		ipRanges = append(ipRanges, (&net.IPNet{IP: ip, Mask: net.CIDRMask(8+rnd.Intn(25), 32)}).String())
+	}
+	idx := newRangeIndex("test", ipRanges)
+	for i := 0; i < 2000; i++ {
+		ip := net.IPv4(10, byte(rnd.Intn(4)), byte(rnd.Intn(256)), byte(rnd.Intn(256)))
+		trie := idx.lookup("test", ip, config{})
+		scan := idx.scan("test", ip, 0)
+		if prefixLenOrNone(trie) != prefixLenOrNone(scan) || (scan != nil && !trie.Contains(ip)) {
+			t.Fatalf("lookup(%s) = %s; scan found %s", ip, trie, scan)
+		}
+	}
+}
+
+func prefixLenOrNone(cidr *net.IPNet) int {
+	if cidr == nil {
+		return -1
+	}
+	return prefixLen(cidr)
+}
@@ -0,0 +1,41 @@
+package cdn
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ValidationHook inspects freshly fetched ranges before they are cached. A
+// non-nil error rejects them: nothing is cached and FetchIPRangesWithCache
+// returns the error.
+type ValidationHook func(provider string, ranges []string) error
+
+// ValidateRanges is the default ValidationHook. It rejects an empty result
+// and any entry that is neither a CIDR nor an IP address.
+func ValidateRanges(provider string, ranges []string) error {
+	if len(ranges) == 0 {
+		return errors.New("no ranges")
+	}
+	for _, r := range ranges {
+		if _, _, err := net.ParseCIDR(r); err != nil && net.ParseIP(r) == nil {
+			return fmt.Errorf("invalid range %q", r)
+		}
+	}
+	return nil
+}
+
+// SetValidationHook sets the validation hook of the default client; see
+// Client.SetValidationHook.
+func SetValidationHook(h ValidationHook) {
+	defaultClient.SetValidationHook(h)
+}
+
+// SetValidationHook replaces ValidateRanges with h, which may call
+// ValidateRanges itself to keep the built-in checks. nil disables
+// validation.
+func (cl *Client) SetValidationHook(h ValidationHook) {
+	cl.SetOptions(func(c *config) {
+		c.validate = h
+	})
+}
@@ -0,0 +1,143 @@
+package cdn
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestValidationHook(t *testing.T) {
+	restoreConfig(t)
+	junk := newStaticProvider("junk", "192.0.2.0/24", "<html>")
+	few := newStaticProvider("few", "192.0.2.0/24")
+	withProviders(t, junk, few)
+
+	if _, err := junk.FetchIPRangesWithCache(context.Background()); err == nil {
+		t.Error("default validation accepted an unparseable entry")
+	}
+	errTooFew := errors.New("too few ranges")
+	SetValidationHook(func(provider string, ranges []string) error {
+		if err := ValidateRanges(provider, ranges); err != nil {
+			return err
+		}
+		if len(ranges) < 2 {
+			return errTooFew
+		}
+		return nil
+	})
+	if _, err := few.FetchIPRangesWithCache(context.Background()); !errors.Is(err, errTooFew) {
+		t.Errorf("FetchIPRangesWithCache error = %v; want %v", err, errTooFew)
+	}
+	if cached := CachedProviders(); len(cached) != 0 {
+		t.Errorf("rejected ranges were cached for %v", cached)
+	}
+
+	SetValidationHook(nil)
+	if _, err := few.FetchIPRangesWithCache(context.Background()); err != nil {
+		t.Errorf("FetchIPRangesWithCache without validation: %v", err)
+	}
+}
+
+func TestMinRanges(t *testing.T) {
+	restoreConfig(t)
+	p := newStaticProvider("shrunk", "192.0.2.0/24")
+	p.minRanges = 3
+	withProviders(t, p)
+	previous := []string{"192.0.2.0/24", "198.51.100.0/24", "203.0.113.0/24"}
+	old := time.Now().Add(-2 * defaultCacheTTL).Unix()
+	if err := p.cache.store(cacheData{Timestamp: old, IPRanges: previous}); err != nil {
+		t.Fatal(err)
+	}
+
+	if ranges, err := p.FetchIPRangesWithCache(context.Background()); err != nil || !slices.Equal(ranges, previous) {
+		t.Errorf("FetchIPRangesWithCache = %v, %v; want the previous ranges", ranges, err)
+	}
+	if stats, _ := GetProviderStats("shrunk"); !errors.Is(stats.LastError, ErrTooFewRanges) {
+		t.Errorf("LastError = %v; want ErrTooFewRanges", stats.LastError)
+	}
+	if cache, err := p.cache.current(); err != nil || !slices.Equal(cache.IPRanges, previous) {
+		t.Errorf("cache = %v, %v; want the previous ranges kept", cache.IPRanges, err)
+	}
+
+	SetOptions(WithMinRanges("shrunk", 0))
+	if ranges, err := p.FetchIPRangesWithCache(context.Background()); err != nil || len(ranges) != 1 {
+		t.Errorf("with the check off: %v, %v", ranges, err)
+	}
+}
+
+func TestReshapedJSONNotCached(t *testing.T) {
+	restoreConfig(t)
+	SetCacheDir(t.TempDir())
+	url := serveText(t, `{"prefixes_v4": ["192.0.2.0/24", "198.51.100.0/24"]}`)
+	for _, p := range []interface {
+		provider
+		setURL(string)
+	}{newCloudFront(), newFastly(), newGCore(), newGoogle(), newKey(), newYandex()} {
+		p.setURL(url)
+		if ranges, err := p.FetchIPRangesWithCache(context.Background()); err == nil {
+			t.Errorf("%T: reshaped response accepted as %v", p, ranges)
+		}
+	}
+	if cached := CachedProviders(); len(cached) != 0 {
+		t.Errorf("reshaped responses were cached for %v", cached)
+	}
+}
+
+func TestRenamedJSONKeys(t *testing.T) {
+	url := serveText(t, `{"Prefixes": ["192.0.2.0/24"], "Addresses": ["192.0.2.0/24"], "ipv4_prefixes": []}`)
+	for _, p := range []interface {
+		FetchIPRanges() ([]string, error)
+		setURL(string)
+	}{newCloudFront(), newFastly(), newGCore(), newGoogle(), newKey()} {
+		p.setURL(url)
+		if ranges, err := p.FetchIPRanges(); !errors.Is(err, ErrUnexpectedFormat) {
+			t.Errorf("%T: FetchIPRanges = %v, %v; want ErrUnexpectedFormat", p, ranges, err)
+		}
+	}
+}
+
+func TestHTMLErrorPageNotCached(t *testing.T) {
+	restoreConfig(t)
+	SetCacheDir(t.TempDir())
+	SetOptions(WithMinRanges(CloudFlare, 0))
+	p := newCloudFlare()
+	p.url = serveFile(t, "testdata/cloudflare-challenge.html").URL
+	previous := []string{"173.245.48.0/20"}
+	old := time.Now().Add(-2 * defaultCacheTTL).Unix()
+	if err := p.cache.store(cacheData{Timestamp: old, IPRanges: previous}); err != nil {
+		t.Fatal(err)
+	}
+
+	if ranges, err := p.FetchIPRangesWithCache(context.Background()); err != nil || !slices.Equal(ranges, previous) {
+		t.Errorf("FetchIPRangesWithCache = %v, %v; want the previous ranges", ranges, err)
+	}
+	_, err := p.refresh(context.Background(), p)
+	var fetchErr *FetchError
+	if !errors.Is(err, ErrUnexpectedFormat) || !errors.As(err, &fetchErr) || fetchErr.Provider != CloudFlare {
+		t.Errorf("refresh error = %v; want a cloudflare FetchError wrapping ErrUnexpectedFormat", err)
+	}
+	if cache, err := p.cache.current(); err != nil || !slices.Equal(cache.IPRanges, previous) {
+		t.Errorf("cache = %v, %v; want the previous ranges kept", cache.IPRanges, err)
+	}
+}
+
+func TestGarbageNotCached(t *testing.T) {
+	restoreConfig(t)
+	SetValidationHook(nil)
+	p := newStaticProvider("garbage", "<html>", "Service Unavailable", "</html>")
+	withProviders(t, p)
+	if _, err := p.FetchIPRangesWithCache(context.Background()); !errors.Is(err, ErrNoValidRanges) {
+		t.Errorf("FetchIPRangesWithCache error = %v; want ErrNoValidRanges", err)
+	}
+	path, err := p.cache.filePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("cache file written for unparseable ranges: %v", err)
+	}
+}
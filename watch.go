@@ -0,0 +1,62 @@
+package cdn
+
+import (
+	"context"
+	"github.com/fsnotify/fsnotify"
+	"path/filepath"
+)
+
+// WatchCacheFiles watches the default client's cache files; see
+// Client.WatchCacheFiles.
+func WatchCacheFiles(ctx context.Context) error {
+	return defaultClient.WatchCacheFiles(ctx)
+}
+
+// WatchCacheFiles watches the cache directory and drops the in-memory copy
+// of a provider's ranges whenever its cache file is changed by something
+// other than this process, e.g. a cron job refreshing the cache, so that the
+// next lookup reloads it from disk. It blocks until ctx is done.
+func (cl *Client) WatchCacheFiles(ctx context.Context) error {
+	dir, err := cl.config().cacheDirPath()
+	if err != nil {
+		return err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	if err = watcher.Add(dir); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			name, ok := cacheFileProvider(filepath.Base(event.Name))
+			if !ok {
+				continue
+			}
+			pro, exists := cl.registry()[name]
+			if !exists {
+				continue
+			}
+			if cm := cacheOf(pro); cm != nil && cm.changedExternally(event.Name) {
+				logger().Info("cache file changed externally", "provider", name, "path", event.Name)
+				cm.evict()
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logger().Warn("cache watcher error", "error", err)
+		}
+	}
+}
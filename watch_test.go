@@ -0,0 +1,50 @@
+package cdn
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWatchCacheFilesEvictsOnExternalWrite(t *testing.T) {
+	p := newStaticProvider("test", "192.0.2.0/24")
+	withProviders(t, p)
+	if _, err := p.FetchIPRangesWithCache(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- WatchCacheFiles(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	path, _ := p.cache.filePath()
+	external, _ := json.Marshal(cacheData{Timestamp: time.Now().Unix(), IPRanges: []string{"198.51.100.0/24"}})
+	want := []string{"198.51.100.0/24"}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		// The watcher may not be registered yet, so keep rewriting.
+		if err := os.WriteFile(path, external, 0644); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+		got, err := p.FetchIPRangesWithCache(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if slices.Equal(got, want) {
+			if n := p.calls.Load(); n != 1 {
+				t.Errorf("FetchIPRanges called %d times; want 1", n)
+			}
+			return
+		}
+	}
+	t.Fatal("external cache change was not picked up")
+}
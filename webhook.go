@@ -0,0 +1,103 @@
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// webhookTimeout bounds a webhook delivery, so that an endpoint that never
+// answers doesn't hold a goroutine.
+const webhookTimeout = 30 * time.Second
+
+type webhookPayload struct {
+	Provider  string    `json:"provider"`
+	Added     []string  `json:"added"`
+	Removed   []string  `json:"removed"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// notifyChange posts the difference between the old and new ranges of a
+// provider to the configured webhook, if any, in the background; the
+// delivery is tracked by cl.webhooks. A webhook URL that validateSourceURL
+// rejects is never posted to.
+func (cl *Client) notifyChange(providerName string, oldRanges, newRanges []string) {
+	c := cl.config()
+	if c.webhookURL == "" {
+		return
+	}
+	if err := cl.validateSourceURL(c.webhookURL); err != nil {
+		logger().Warn("webhook not delivered", "provider", providerName, "error", err)
+		return
+	}
+	added, removed := DiffRanges(oldRanges, newRanges)
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+	body, err := json.Marshal(webhookPayload{
+		Provider:  providerName,
+		Added:     added,
+		Removed:   removed,
+		Timestamp: time.Now().UTC(),
+	})
+	if err != nil {
+		logger().Error("webhook payload", "provider", providerName, "error", err)
+		return
+	}
+	cl.webhooks.Add(1)
+	go func() {
+		defer cl.webhooks.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, "POST", c.webhookURL, bytes.NewReader(body))
+		if err != nil {
+			logger().Warn("webhook delivery failed", "provider", providerName, "error", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if c.webhookSecret != "" {
+			mac := hmac.New(sha256.New, []byte(c.webhookSecret))
+			mac.Write(body)
+			req.Header.Set("X-CDN-Signature", hex.EncodeToString(mac.Sum(nil)))
+		}
+		resp, err := cl.httpClient("").Do(req)
+		if err != nil {
+			logger().Warn("webhook delivery failed", "provider", providerName, "error", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			logger().Warn("webhook delivery failed", "provider", providerName, "status", resp.Status)
+			return
+		}
+		logger().Debug("webhook delivered", "provider", providerName, "added", len(added), "removed", len(removed))
+	}()
+}
+
+// WaitWebhooks waits for the default client's webhook deliveries; see
+// Client.WaitWebhooks.
+func WaitWebhooks(ctx context.Context) error {
+	return defaultClient.WaitWebhooks(ctx)
+}
+
+// WaitWebhooks waits until the webhook deliveries in progress are done, for
+// example before the program exits, and returns ctx.Err() if ctx is done
+// first. Each delivery is given up after 30 seconds anyway.
+func (cl *Client) WaitWebhooks(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		cl.webhooks.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,136 @@
+package cdn
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWithWebhook(t *testing.T) {
+	restoreConfig(t)
+	type delivery struct {
+		body      []byte
+		signature string
+	}
+	deliveries := make(chan delivery, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- delivery{body, r.Header.Get("X-CDN-Signature")}
+	}))
+	defer srv.Close()
+	p := newStaticProvider("test", "192.0.2.0/24", "198.51.100.0/24")
+	withProviders(t, p)
+	SetOptions(WithAllowInsecureHTTP(true), WithWebhook(srv.URL, "s3cret"))
+
+	old := time.Now().Add(-2 * defaultCacheTTL).Unix()
+	if err := p.cache.store(cacheData{Timestamp: old, IPRanges: []string{"192.0.2.0/24", "203.0.113.0/24"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.FetchIPRangesWithCache(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var d delivery
+	select {
+	case d = <-deliveries:
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not called")
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(d.body)
+	if want := hex.EncodeToString(mac.Sum(nil)); d.signature != want {
+		t.Errorf("signature = %q; want %q", d.signature, want)
+	}
+	var payload webhookPayload
+	if err := json.Unmarshal(d.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Provider != "test" || !slices.Equal(payload.Added, []string{"198.51.100.0/24"}) ||
+		!slices.Equal(payload.Removed, []string{"203.0.113.0/24"}) || payload.Timestamp.IsZero() {
+		t.Errorf("payload = %+v", payload)
+	}
+
+	if err := p.cache.store(cacheData{Timestamp: old, IPRanges: p.ranges}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.FetchIPRangesWithCache(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := WaitWebhooks(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case d = <-deliveries:
+		t.Errorf("webhook called without changes: %s", d.body)
+	default:
+	}
+
+	SetOptions(WithWebhook(srv.URL, ""))
+	if err := p.cache.store(cacheData{Timestamp: old, IPRanges: []string{"203.0.113.0/24"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.FetchIPRangesWithCache(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := WaitWebhooks(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case d = <-deliveries:
+		if d.signature != "" {
+			t.Errorf("signature %q without a secret", d.signature)
+		}
+	default:
+		t.Error("webhook not called without a secret")
+	}
+}
+
+func TestWebhookRequiresHTTPS(t *testing.T) {
+	restoreConfig(t)
+	called := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called <- struct{}{}
+	}))
+	defer srv.Close()
+	p := newStaticProvider("test", "192.0.2.0/24")
+	withProviders(t, p)
+	SetOptions(WithWebhook(srv.URL, "s3cret"))
+
+	old := time.Now().Add(-2 * defaultCacheTTL).Unix()
+	if err := p.cache.store(cacheData{Timestamp: old, IPRanges: []string{"203.0.113.0/24"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.FetchIPRangesWithCache(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := WaitWebhooks(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-called:
+		t.Error("webhook posted over plain http")
+	default:
+	}
+}
+
+func TestWaitWebhooks(t *testing.T) {
+	cl := NewClient()
+	cl.webhooks.Add(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := cl.WaitWebhooks(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitWebhooks with a delivery in progress = %v; want context.DeadlineExceeded", err)
+	}
+	cl.webhooks.Done()
+	if err := cl.WaitWebhooks(context.Background()); err != nil {
+		t.Errorf("WaitWebhooks = %v", err)
+	}
+}